@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// AdminAuth requires the key as a bearer token. Without a key every request
+// is refused, so the admin endpoints are disabled unless one is configured.
+func AdminAuth(key string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key == "" {
+			http.Error(w, "admin endpoints are disabled, set ADMIN_API_KEY to enable them", http.StatusForbidden)
+			return
+		}
+		token := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(token, []byte("Bearer "+key)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_AdminAuth(t *testing.T) {
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	tests := []struct {
+		name          string
+		key           string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no key configured", wantStatus: http.StatusForbidden},
+		{name: "no key configured with empty bearer", authorization: "Bearer ", wantStatus: http.StatusForbidden},
+		{name: "valid key", key: "secret", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "wrong key", key: "secret", authorization: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "missing key", key: "secret", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/admin/backfill", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			AdminAuth(tt.key, ok)(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("AdminAuth() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+// allIndexersName is the name used to refer to the aggregation of all indexers.
+const allIndexersName = "all"
+
+// HandlerAllIndexers fans the query out to all registered indexers concurrently
+// and merges their results by info hash.
+// Besides the common query params, it accepts "indexers" with a comma
+// separated list of indexer names to restrict the search to.
+func (i *Indexer) HandlerAllIndexers(w http.ResponseWriter, r *http.Request) {
+	if contentType := streamContentType(r); contentType != "" {
+		names, err := selectIndexers(r.URL.Query().Get("indexers"))
+		if err != nil {
+			writeError(w, r, IndexingError{Code: ErrCodeBadRequest, Message: err.Error()})
+			return
+		}
+		i.serveAllStream(w, r, names, contentType)
+		return
+	}
+
+	resp, err := i.runAllIndexers(r)
+	if err != nil && len(resp.Indexers) == 0 {
+		writeError(w, r, newIndexingError("", "", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		// every indexer failed, the statuses tell why
+		w.WriteHeader(http.StatusBadGateway)
+	} else if len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to encode response")
+	}
+}
+
+// runAllIndexers runs the selected indexers concurrently, merges the results by
+// info hash and applies the post-processors once over the merged set.
+// An error is returned if the selection is invalid or if every indexer failed.
+func (i *Indexer) runAllIndexers(r *http.Request) (Response, error) {
+	names, err := selectIndexers(r.URL.Query().Get("indexers"))
+	if err != nil {
+		return Response{}, IndexingError{Code: ErrCodeBadRequest, Message: err.Error()}
+	}
+
+	statuses, results, errs := i.scrapeIndexers(r, names, nil)
+
+	merged := mergeByInfoHash(results...)
+	postProcessedTorrents := i.postProcess(r, merged)
+
+	resp := Response{
+		Results:      postProcessedTorrents,
+		Count:        len(postProcessedTorrents),
+		IndexedCount: len(merged),
+		Indexers:     statuses,
+		Errors:       errs,
+	}
+
+	if !anySucceeded(statuses) {
+		return resp, IndexingError{Code: ErrCodeAllFailed, Message: "all indexers failed"}
+	}
+	return resp, nil
+}
+
+// scrapeIndexers runs the named indexers concurrently and returns the status
+// and the raw results of each one, in the order of the names, and the errors
+// of the indexers and posts that failed.
+// If emit is not nil, it receives the results of each post as soon as they are parsed.
+func (i *Indexer) scrapeIndexers(r *http.Request, names []string, emit func([]schema.IndexedTorrent)) ([]IndexerStatus, [][]schema.IndexedTorrent, []IndexingError) {
+	statuses := make([]IndexerStatus, len(names))
+	results := make([][]schema.IndexedTorrent, len(names))
+	errs := make([][]IndexingError, len(names))
+
+	var wg sync.WaitGroup
+	for idx, name := range names {
+		wg.Add(1)
+		go func(idx int, name string) {
+			defer wg.Done()
+			site, _ := LookupSite(name)
+
+			start := time.Now()
+			torrents, postErrors, err := i.scrape(r, site, emit)
+			statuses[idx] = IndexerStatus{
+				Name:      name,
+				Success:   err == nil,
+				Count:     len(torrents),
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				ie := newIndexingError(name, "", err)
+				statuses[idx].Error = ie.Message
+				statuses[idx].Code = ie.Code
+				errs[idx] = []IndexingError{ie}
+				logging.WarnWithRequest(r).Err(err).Str("indexer", name).Msg("Indexer failed in aggregated search")
+				return
+			}
+			results[idx] = torrents
+			errs[idx] = postErrors
+		}(idx, name)
+	}
+	wg.Wait()
+
+	return statuses, results, slices.Concat(errs...)
+}
+
+// anySucceeded reports whether at least one indexer succeeded.
+func anySucceeded(statuses []IndexerStatus) bool {
+	return slices.ContainsFunc(statuses, func(s IndexerStatus) bool { return s.Success })
+}
+
+// runnerFor returns the function that runs the named indexer, or all of them
+// for "all". It returns false if there is no such indexer.
+func (i *Indexer) runnerFor(name string) (func(r *http.Request) (Response, error), bool) {
+	if name == allIndexersName {
+		return i.runAllIndexers, true
+	}
+	site, ok := LookupSite(name)
+	if !ok {
+		return nil, false
+	}
+	return func(r *http.Request) (Response, error) {
+		return i.runIndexer(r, site)
+	}, true
+}
+
+// selectIndexers parses a comma separated list of indexer names.
+// If the list is empty, all registered indexers are returned.
+func selectIndexers(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return slices.Sorted(slices.Values(SiteNames())), nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := LookupSite(name); !ok {
+			return nil, fmt.Errorf("unknown indexer: %s", name)
+		}
+		names = append(names, name)
+	}
+	names = slices.Compact(slices.Sorted(slices.Values(names)))
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no indexers selected")
+	}
+	return names, nil
+}
+
+// mergeByInfoHash merges the results of several indexers, keeping a single
+// entry for each info hash. Missing metadata of the first occurrence is
+// completed with the duplicates, since many sites repost the same magnet.
+func mergeByInfoHash(results ...[]schema.IndexedTorrent) []schema.IndexedTorrent {
+	merged := []schema.IndexedTorrent{}
+	seen := make(map[string]int)
+
+	for _, torrents := range results {
+		for _, it := range torrents {
+			key := strings.ToLower(it.InfoHash)
+			if key == "" {
+				merged = append(merged, it)
+				continue
+			}
+
+			idx, ok := seen[key]
+			if !ok {
+				seen[key] = len(merged)
+				merged = append(merged, it)
+				continue
+			}
+
+			merged[idx] = mergeIndexedTorrent(merged[idx], it)
+		}
+	}
+
+	return merged
+}
+
+// mergeIndexedTorrent fills the empty fields of a with the ones from b.
+func mergeIndexedTorrent(a, b schema.IndexedTorrent) schema.IndexedTorrent {
+	a.Audio = slices.Clone(a.Audio)
+	a.Trackers = slices.Clone(a.Trackers)
+
+	if a.Title == "" {
+		a.Title = b.Title
+	}
+	if a.OriginalTitle == "" {
+		a.OriginalTitle = b.OriginalTitle
+	}
+	if a.Year == "" {
+		a.Year = b.Year
+	}
+	if a.IMDB == "" {
+		a.IMDB = b.IMDB
+	}
+	if a.Size == "" {
+		a.Size = b.Size
+	}
+	if len(a.Files) == 0 {
+		a.Files = b.Files
+	}
+	if a.Date.IsZero() || (!b.Date.IsZero() && b.Date.Before(a.Date)) {
+		a.Date = b.Date
+	}
+	if b.SeedCount > a.SeedCount {
+		a.SeedCount = b.SeedCount
+	}
+	if b.LeechCount > a.LeechCount {
+		a.LeechCount = b.LeechCount
+	}
+
+	for _, audio := range b.Audio {
+		if !slices.Contains(a.Audio, audio) {
+			a.Audio = append(a.Audio, audio)
+		}
+	}
+	for _, tracker := range b.Trackers {
+		if !slices.Contains(a.Trackers, tracker) {
+			a.Trackers = append(a.Trackers, tracker)
+		}
+	}
+
+	return a
+}
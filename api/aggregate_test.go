@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func Test_mergeByInfoHash(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	bludvResults := []schema.IndexedTorrent{
+		{
+			Title:      "Movie.2025.1080p",
+			InfoHash:   "e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			Details:    "https://bludv.example/movie",
+			Audio:      []schema.Audio{schema.AudioPortuguese},
+			Date:       newer,
+			SeedCount:  3,
+			LeechCount: 7,
+		},
+		{Title: "Other.2025.720p", InfoHash: "aaaa6e84e4d763a8fa70bf156f5bd30b61f2fc5c"},
+	}
+	comandoResults := []schema.IndexedTorrent{
+		{
+			Title:      "Movie.2025.1080p",
+			InfoHash:   "E9A96E84E4D763A8FA70BF156F5BD30B61F2FC5C",
+			Details:    "https://comando.example/movie",
+			IMDB:       "https://www.imdb.com/title/tt1234567/",
+			Size:       "2.5 GB",
+			Audio:      []schema.Audio{schema.AudioPortuguese, schema.AudioEnglish},
+			Date:       older,
+			SeedCount:  10,
+			LeechCount: 1,
+		},
+	}
+
+	want := []schema.IndexedTorrent{
+		{
+			Title:      "Movie.2025.1080p",
+			InfoHash:   "e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			Details:    "https://bludv.example/movie",
+			IMDB:       "https://www.imdb.com/title/tt1234567/",
+			Size:       "2.5 GB",
+			Audio:      []schema.Audio{schema.AudioPortuguese, schema.AudioEnglish},
+			Date:       older,
+			SeedCount:  10,
+			LeechCount: 7,
+		},
+		{Title: "Other.2025.720p", InfoHash: "aaaa6e84e4d763a8fa70bf156f5bd30b61f2fc5c"},
+	}
+
+	got := mergeByInfoHash(bludvResults, comandoResults)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeByInfoHash() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_selectIndexers(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "should select the given indexers once",
+			param: "vaca_torrent, bludv,bludv",
+			want:  []string{"bludv", "vaca_torrent"},
+		},
+		{
+			name:    "should fail on unknown indexer",
+			param:   "bludv,filme_torrent",
+			wantErr: true,
+		},
+		{
+			name:  "should select all indexers when empty",
+			param: "",
+			want:  []string{"bludv", "comando_torrents", "rede_torrent", "starck-filmes", "torrent-dos-filmes", "vaca_torrent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectIndexers(tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectIndexers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectIndexers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
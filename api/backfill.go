@@ -0,0 +1,371 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+// States of a backfill.
+const (
+	BackfillRunning = "running"
+	BackfillStopped = "stopped"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+const (
+	defaultBackfillDelay = 2 * time.Second
+	// maxBackfillPageFailures is the number of list pages failing in a row
+	// after which the backfill fails, since the site is likely down.
+	maxBackfillPageFailures = 5
+	// backfillCheckpointExpiration keeps the checkpoints long enough to resume
+	// a backfill of a large site, which can take days.
+	backfillCheckpointExpiration = 30 * 24 * time.Hour
+)
+
+// BackfillConfig configures the backfills.
+type BackfillConfig struct {
+	Delay    time.Duration // time waited before each request, to be polite with the sites
+	MaxPages int           // last list page walked, 0 walks back to the beginning
+}
+
+// BackfillStatus is the checkpoint of the backfill of a site, persisted so it
+// can be resumed after a restart.
+type BackfillStatus struct {
+	Name          string    `json:"name"`
+	State         string    `json:"state"`
+	Page          int       `json:"page"` // last list page completed
+	Posts         int       `json:"posts"`
+	Skipped       int       `json:"skipped"` // posts already seen or in the long-lived cache
+	Torrents      int       `json:"torrents"`
+	Errors        int       `json:"errors"`
+	FailedPages   []int     `json:"failed_pages,omitempty"` // list pages that could not be fetched
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorCode string    `json:"last_error_code,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Backfiller walks every list page of a site back to the beginning, sending
+// the posts to the search index. It is safe for concurrent use.
+type Backfiller struct {
+	indexer *Indexer
+	config  BackfillConfig
+
+	mu   sync.Mutex
+	jobs map[string]context.CancelFunc
+}
+
+func NewBackfiller(i *Indexer, config BackfillConfig) *Backfiller {
+	if config.Delay <= 0 {
+		config.Delay = defaultBackfillDelay
+	}
+	return &Backfiller{
+		indexer: i,
+		config:  config,
+		jobs:    make(map[string]context.CancelFunc),
+	}
+}
+
+func backfillKey(name string) string {
+	return "backfill:" + name
+}
+
+// seenKey marks a post walked by the backfill started at status.StartedAt.
+// The pages shift as new posts are published, so the posts of the last pages
+// are walked again on resume; a restart has a new start and walks them all.
+func seenKey(status *BackfillStatus, link string) string {
+	return fmt.Sprintf("%s:%d:seen:%s", backfillKey(status.Name), status.StartedAt.Unix(), link)
+}
+
+// seen reports whether the backfill already walked the post.
+func (b *Backfiller) seen(ctx context.Context, status *BackfillStatus, link string) bool {
+	_, err := b.indexer.redis.Get(ctx, seenKey(status, link))
+	return err == nil
+}
+
+// markSeen records that the backfill walked the post, for as long as its checkpoint.
+func (b *Backfiller) markSeen(ctx context.Context, status *BackfillStatus, link string) {
+	err := b.indexer.redis.SetWithExpiration(ctx, seenKey(status, link), []byte("1"), backfillCheckpointExpiration)
+	if err != nil {
+		logging.Error().Err(err).Str("indexer", status.Name).Str("url", link).Msg("Failed to mark backfill post as seen")
+	}
+}
+
+// load returns the checkpoint of the site, or a new one if there is none.
+func (b *Backfiller) load(ctx context.Context, name string) (*BackfillStatus, error) {
+	content, err := b.indexer.redis.Get(ctx, backfillKey(name))
+	if err != nil {
+		return &BackfillStatus{Name: name, State: BackfillStopped}, nil
+	}
+
+	var status BackfillStatus
+	if err := json.Unmarshal(content, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse backfill checkpoint: %w", err)
+	}
+	return &status, nil
+}
+
+// save persists the checkpoint of the site.
+func (b *Backfiller) save(ctx context.Context, status *BackfillStatus) {
+	status.UpdatedAt = time.Now()
+	content, err := json.Marshal(status)
+	if err == nil {
+		err = b.indexer.redis.SetWithExpiration(ctx, backfillKey(status.Name), content, backfillCheckpointExpiration)
+	}
+	if err != nil {
+		logging.Error().Err(err).Str("indexer", status.Name).Msg("Failed to save backfill checkpoint")
+	}
+}
+
+// Start starts the backfill of the site, resuming it from its checkpoint
+// unless restart is set, and returns its checkpoint.
+// It fails if the backfill is already running.
+func (b *Backfiller) Start(name string, restart bool) (*BackfillStatus, error) {
+	s, ok := LookupSite(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown indexer: %s", name)
+	}
+	if s.Meta().PagePattern == "" {
+		return nil, fmt.Errorf("indexer has no pagination: %s", name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.jobs[name]; ok {
+		return nil, fmt.Errorf("backfill already running: %s", name)
+	}
+
+	status, err := b.load(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	if restart || status.State == BackfillDone {
+		status = &BackfillStatus{Name: name}
+	}
+	if status.StartedAt.IsZero() {
+		status.StartedAt = time.Now()
+	}
+	status.State = BackfillRunning
+	b.save(context.Background(), status)
+
+	// the status is owned by the backfill from now on
+	started := *status
+	ctx, cancel := context.WithCancel(context.Background())
+	b.jobs[name] = cancel
+	go b.run(ctx, s, status)
+	return &started, nil
+}
+
+// Stop stops the backfill of the site, keeping its checkpoint.
+func (b *Backfiller) Stop(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cancel, ok := b.jobs[name]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Resume restarts the backfills that were running when the process stopped.
+func (b *Backfiller) Resume() {
+	for _, name := range SiteNames() {
+		status, err := b.load(context.Background(), name)
+		if err != nil || status.State != BackfillRunning {
+			continue
+		}
+		logging.Info().Str("indexer", name).Int("page", status.Page).Msg("Resuming backfill")
+		if _, err := b.Start(name, false); err != nil {
+			logging.Error().Err(err).Str("indexer", name).Msg("Failed to resume backfill")
+		}
+	}
+}
+
+// Status returns the checkpoint of the site.
+func (b *Backfiller) Status(ctx context.Context, name string) (*BackfillStatus, error) {
+	return b.load(ctx, name)
+}
+
+// wait sleeps for the politeness delay, returning false if the context is done.
+func (b *Backfiller) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(b.config.Delay):
+		return true
+	}
+}
+
+// run walks the list pages after the checkpoint until one has no posts. The
+// pages that fail are recorded and skipped, unless too many fail in a row.
+func (b *Backfiller) run(ctx context.Context, s Site, status *BackfillStatus) {
+	name := s.Meta().Name
+	defer func() {
+		b.mu.Lock()
+		delete(b.jobs, name)
+		b.mu.Unlock()
+		// the checkpoint must be saved even if the backfill was stopped
+		b.save(context.Background(), status)
+		logging.Info().Str("indexer", name).Str("state", status.State).Int("page", status.Page).
+			Int("torrents", status.Torrents).Msg("Backfill finished")
+	}()
+
+	failures := 0
+	for page := status.Page + 1; b.config.MaxPages == 0 || page <= b.config.MaxPages; page++ {
+		if !b.wait(ctx) {
+			status.State = BackfillStopped
+			return
+		}
+		done, err := b.walkPage(ctx, s, status, page)
+		if errors.Is(err, context.Canceled) {
+			status.State = BackfillStopped
+			return
+		}
+		if err != nil {
+			ie := newIndexingError(name, s.SearchURL("", strconv.Itoa(page)), err)
+			status.Errors++
+			status.LastError, status.LastErrorCode = ie.Message, ie.Code
+			status.FailedPages = append(status.FailedPages, page)
+			logging.Warn().Str("indexer", name).Int("page", page).Str("code", ie.Code).Msg(ie.Message)
+			if failures++; failures >= maxBackfillPageFailures {
+				status.State = BackfillFailed
+				return
+			}
+		} else {
+			failures = 0
+		}
+		if done {
+			break
+		}
+		status.Page = page
+		b.save(ctx, status)
+	}
+	status.State = BackfillDone
+}
+
+// walkPage indexes the posts of the list page that were not seen yet. It
+// reports whether the page has no posts, meaning the beginning was reached.
+func (b *Backfiller) walkPage(ctx context.Context, s Site, status *BackfillStatus, page int) (bool, error) {
+	name := s.Meta().Name
+	i := b.indexer
+
+	pageParam := ""
+	if page > 1 {
+		pageParam = strconv.Itoa(page)
+	}
+	targetURL := s.SearchURL("", pageParam)
+	doc, err := i.getListDocument(ctx, targetURL)
+	if err != nil {
+		return false, err
+	}
+	links := s.ExtractLinks(doc)
+	if len(links) == 0 {
+		return true, nil
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/indexers/"+name, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, link := range links {
+		if b.seen(ctx, status, link) {
+			status.Skipped++
+			continue
+		}
+		// the posts in the long-lived cache were already parsed, and indexed, before
+		if _, err := i.redis.Get(ctx, link); err == nil {
+			b.markSeen(ctx, status, link)
+			status.Skipped++
+			continue
+		}
+		if !b.wait(ctx) {
+			return false, context.Canceled
+		}
+
+		torrents, err := s.ParsePost(ctx, i, link, targetURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, context.Canceled
+			}
+			ie := newIndexingError(name, link, err)
+			status.Errors++
+			status.LastError, status.LastErrorCode = ie.Message, ie.Code
+			logging.Warn().Str("indexer", name).Str("url", link).Str("code", ie.Code).Msg(ie.Message)
+			continue
+		}
+		for idx := range torrents {
+			torrents[idx].Details = i.requester.ResolveMirror(ctx, torrents[idx].Details)
+		}
+		b.markSeen(ctx, status, link)
+		status.Posts++
+		status.Torrents += len(i.postProcess(r, torrents))
+	}
+	return false, nil
+}
+
+// HandlerBackfill manages the backfill of the indexer in the path:
+// GET reports its progress, POST starts or resumes it (restart=true starts it
+// over) and DELETE stops it. Without an indexer, GET reports every indexer.
+func (b *Backfiller) HandlerBackfill(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("indexer")
+	if _, ok := LookupSite(name); name != "" && !ok {
+		http.Error(w, fmt.Sprintf("unknown indexer: %s", name), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var resp any
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		names := SiteNames()
+		statuses := make([]BackfillStatus, 0, len(names))
+		for _, n := range names {
+			status, err := b.Status(r.Context(), n)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			statuses = append(statuses, *status)
+		}
+		resp = statuses
+	case r.Method == http.MethodGet:
+		status, err := b.Status(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = status
+	case r.Method == http.MethodPost && name != "":
+		status, err := b.Start(name, r.URL.Query().Get("restart") == "true")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		resp = status
+	case r.Method == http.MethodDelete && name != "":
+		if !b.Stop(name) {
+			http.Error(w, fmt.Sprintf("backfill not running: %s", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		resp = map[string]string{"name": name, "state": BackfillStopped}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to encode response")
+	}
+}
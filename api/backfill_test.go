@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+func Test_Backfiller(t *testing.T) {
+	i := newFixtureIndexer(t, filepath.Join("testdata", "sites", "bludv"))
+	site, _ := LookupSite("bludv")
+	b := NewBackfiller(i, BackfillConfig{Delay: time.Millisecond, MaxPages: 1})
+
+	first := &BackfillStatus{Name: "bludv"}
+	b.run(context.Background(), site, first)
+	if first.State != BackfillDone || first.Page != 1 {
+		t.Fatalf("backfill = %s at page %d, want %s at page 1", first.State, first.Page, BackfillDone)
+	}
+	if first.Posts == 0 || first.Torrents == 0 || first.Errors != 0 {
+		t.Errorf("backfill = %d posts, %d torrents, %d errors, want posts with torrents and no errors", first.Posts, first.Torrents, first.Errors)
+	}
+
+	checkpoint, err := b.Status(context.Background(), "bludv")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if checkpoint.State != BackfillDone || checkpoint.Page != 1 || checkpoint.Posts != first.Posts {
+		t.Errorf("checkpoint = %s at page %d with %d posts, want %s at page 1 with %d", checkpoint.State, checkpoint.Page, checkpoint.Posts, BackfillDone, first.Posts)
+	}
+	content, _ := i.redis.Get(context.Background(), backfillKey("bludv"))
+	if strings.Contains(string(content), "http") {
+		t.Errorf("checkpoint = %s, want no post URLs", content)
+	}
+
+	// the posts are now in the long-lived cache
+	second := &BackfillStatus{Name: "bludv"}
+	b.run(context.Background(), site, second)
+	if second.Posts != 0 || second.Skipped != first.Posts {
+		t.Errorf("second backfill = %d posts, %d skipped, want 0 posts and %d skipped", second.Posts, second.Skipped, first.Posts)
+	}
+}
+
+// failingPageTransport answers the first list page of bludv with a 500 and
+// serves the second one from the fixture of the first.
+type failingPageTransport struct {
+	fixtureTransport
+}
+
+func (t failingPageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Path {
+	case "/":
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	case "/page/2":
+		req = req.Clone(req.Context())
+		req.URL.Path = "/"
+	}
+	return t.fixtureTransport.RoundTrip(req)
+}
+
+func Test_Backfiller_failedPage(t *testing.T) {
+	dir := filepath.Join("testdata", "sites", "bludv")
+	i := newFixtureIndexer(t, dir)
+	server, _ := url.Parse(newFixtureServer(t, dir).URL)
+	i.requester.SetTransport(failingPageTransport{fixtureTransport{server: server}})
+	i.requester.SetRetryConfig(requester.RetryConfig{Retries: 0, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	site, _ := LookupSite("bludv")
+	b := NewBackfiller(i, BackfillConfig{Delay: time.Millisecond, MaxPages: 2})
+
+	status := &BackfillStatus{Name: "bludv"}
+	b.run(context.Background(), site, status)
+	if status.State != BackfillDone || status.Page != 2 {
+		t.Fatalf("backfill = %s at page %d, want %s at page 2", status.State, status.Page, BackfillDone)
+	}
+	if !slices.Equal(status.FailedPages, []int{1}) || status.Errors != 1 || status.LastErrorCode == "" {
+		t.Errorf("backfill failed pages = %v, %d errors, code %q, want page 1 with its error", status.FailedPages, status.Errors, status.LastErrorCode)
+	}
+	if status.Posts == 0 {
+		t.Errorf("backfill posts = 0, want the posts of page 2")
+	}
+}
+
+func Test_Backfiller_stopped(t *testing.T) {
+	i := newFixtureIndexer(t, filepath.Join("testdata", "sites", "bludv"))
+	site, _ := LookupSite("bludv")
+	b := NewBackfiller(i, BackfillConfig{Delay: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status := &BackfillStatus{Name: "bludv", Page: 3}
+	b.run(ctx, site, status)
+	if status.State != BackfillStopped || status.Page != 3 {
+		t.Errorf("backfill = %s at page %d, want %s at page 3", status.State, status.Page, BackfillStopped)
+	}
+}
+
+func Test_HandlerBackfill(t *testing.T) {
+	i := newFixtureIndexer(t, filepath.Join("testdata", "sites", "bludv"))
+	b := NewBackfiller(i, BackfillConfig{})
+
+	tests := []struct {
+		method     string
+		indexer    string
+		wantStatus int
+	}{
+		{method: "GET", wantStatus: http.StatusOK},
+		{method: "GET", indexer: "bludv", wantStatus: http.StatusOK},
+		{method: "GET", indexer: "unknown", wantStatus: http.StatusNotFound},
+		{method: "POST", indexer: "unknown", wantStatus: http.StatusNotFound},
+		{method: "DELETE", indexer: "bludv", wantStatus: http.StatusNotFound},
+		{method: "PUT", indexer: "bludv", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.indexer, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/backfill/"+tt.indexer, nil)
+			r.SetPathValue("indexer", tt.indexer)
+			w := httptest.NewRecorder()
+			b.HandlerBackfill(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("HandlerBackfill() status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -2,113 +2,49 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 
-	"github.com/felipemarinho97/torrent-indexer/logging"
-	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/schema"
-	goscrape "github.com/felipemarinho97/torrent-indexer/scrape"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
 var bludv = IndexerMeta{
+	Name:        "bludv",
 	Label:       "bludv",
 	URL:         utils.GetIndexerURLFromEnv("INDEXER_BLUDV_URL", "https://bludv-v1.xyz/"),
+	Mirrors:     utils.GetIndexerMirrorsFromEnv("INDEXER_BLUDV_MIRRORS"),
 	SearchURL:   "?s=",
 	PagePattern: "page/%s",
 }
 
-func (i *Indexer) HandlerBluDVIndexer(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	metadata := bludv
+type bludvSite struct{}
 
-	defer func() {
-		i.metrics.IndexerDuration.WithLabelValues(metadata.Label).Observe(time.Since(start).Seconds())
-		i.metrics.IndexerRequests.WithLabelValues(metadata.Label).Inc()
-	}()
-
-	ctx := r.Context()
-	// supported query params: q, season, episode, page, filter_results
-	q := r.URL.Query().Get("q")
-	page := r.URL.Query().Get("page")
+func (bludvSite) Meta() IndexerMeta {
+	return bludv
+}
 
-	// URL encode query param
-	q = url.QueryEscape(q)
-	url := metadata.URL
+func (bludvSite) SearchURL(q, page string) string {
+	// bludv gives priority to the page number over the search query
 	if page != "" {
-		url = fmt.Sprintf(fmt.Sprintf("%s%s", url, metadata.PagePattern), page)
-	} else {
-		url = fmt.Sprintf("%s%s%s", url, metadata.SearchURL, q)
-	}
-
-	logging.InfoWithRequest(r).Str("target_url", url).Msg("Processing indexer request")
-	resp, err := i.requester.GetDocument(ctx, url)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
+		return fmt.Sprintf(fmt.Sprintf("%s%s", bludv.URL, bludv.PagePattern), page)
 	}
-	defer resp.Close()
-
-	doc, err := goquery.NewDocumentFromReader(resp)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
-	}
-
-	var links []string
-	doc.Find(".post").Each(func(i int, s *goquery.Selection) {
-		// get link from h2.entry-title > a
-		link, _ := s.Find("div.title > a").Attr("href")
-		links = append(links, link)
-	})
-
-	// if no links were indexed, expire the document in cache
-	if len(links) == 0 {
-		_ = i.requester.ExpireDocument(ctx, url)
-	}
-
-	// extract each torrent link
-	indexedTorrents := utils.ParallelFlatMap(links, func(link string) ([]schema.IndexedTorrent, error) {
-		return getTorrentsBluDV(ctx, i, link, url)
-	})
+	return fmt.Sprintf("%s%s%s", bludv.URL, bludv.SearchURL, url.QueryEscape(q))
+}
 
-	// Apply post-processors
-	postProcessedTorrents := indexedTorrents
-	for _, processor := range i.postProcessors {
-		postProcessedTorrents = processor(i, r, postProcessedTorrents)
-	}
+func (bludvSite) ExtractLinks(doc *goquery.Document) []string {
+	return findLinks(doc, ".post", "div.title > a")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(Response{
-		Results:      postProcessedTorrents,
-		Count:        len(postProcessedTorrents),
-		IndexedCount: len(indexedTorrents),
-	})
-	if err != nil {
-		logging.Error().Err(err).Msg("Failed to encode response")
-	}
+func (bludvSite) ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
+	return getTorrentsBluDV(ctx, i, link, referer)
 }
 
 func getTorrentsBluDV(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
-	var indexedTorrents []schema.IndexedTorrent
 	doc, err := getDocument(ctx, i, link, referer)
 	if err != nil {
 		return nil, err
@@ -118,48 +54,7 @@ func getTorrentsBluDV(ctx context.Context, i *Indexer, link, referer string) ([]
 	title := strings.Replace(article.Find(".title > h1").Text(), " - Download", "", -1)
 	textContent := article.Find("div.content")
 	date := getPublishedDate(doc)
-	magnets := textContent.Find("a[href^=\"magnet\"]")
-	var magnetLinks []string
-	magnets.Each(func(i int, s *goquery.Selection) {
-		magnetLink, _ := s.Attr("href")
-		magnetLinks = append(magnetLinks, magnetLink)
-	})
-
-	adwareDomains := []string{
-		"https://www.seuvideo.xyz",
-		"https://www.systemads.org",
-	}
-
-	// Process adware links for each domain in the list
-	for _, domain := range adwareDomains {
-		adwareLinks := textContent.Find(fmt.Sprintf("a[href^=\"%s\"]", domain))
-		adwareLinks.Each(func(_ int, s *goquery.Selection) {
-			href, _ := s.Attr("href")
-			// extract querysting "id" from url
-			parsedUrl, err := url.Parse(href)
-			if err != nil {
-				logging.Error().Err(err).Str("href", href).Msg("Failed to parse URL")
-				return
-			}
-			magnetLink := parsedUrl.Query().Get("id")
-			magnetLinkDecoded, err := utils.DecodeAdLink(magnetLink)
-			if err != nil {
-				logging.Error().Err(err).Str("href", href).Msg("Failed to decode ad link")
-				return
-			}
-
-			// if decoded magnet link is indeed a magnet link, append it
-			if strings.HasPrefix(magnetLinkDecoded, "magnet:") {
-				magnetLinks = append(magnetLinks, magnetLinkDecoded)
-			} else if !strings.Contains(magnetLinkDecoded, "watch.brplayer") {
-				logging.Warn().
-					Str("href", href).
-					Str("decoded", magnetLinkDecoded).
-					Str("indexer", bludv.Label).
-					Msg("Link decoding resulted in non-magnet link")
-			}
-		})
-	}
+	magnetLinks := findMagnetLinks(ctx, i, textContent)
 
 	var audio []schema.Audio
 	var year string
@@ -201,66 +96,20 @@ func getTorrentsBluDV(ctx context.Context, i *Indexer, link, referer string) ([]
 		}
 	})
 
-	size = utils.StableUniq(size)
-
-	var chanIndexedTorrent = make(chan schema.IndexedTorrent)
-
-	// for each magnet link, create a new indexed torrent
-	for it, magnetLink := range magnetLinks {
-		it := it
-		go func(it int, magnetLink string) {
-			magnet, err := magnet.ParseMagnetUri(magnetLink)
-			if err != nil {
-				logging.Error().Err(err).Str("magnet_link", magnetLink).Msg("Failed to parse magnet URI")
-			}
-			releaseTitle := magnet.DisplayName
-			infoHash := magnet.InfoHash.String()
-			trackers := magnet.Trackers
-			magnetAudio := getAudioFromTitle(releaseTitle, audio)
-
-			peer, seed, err := goscrape.GetLeechsAndSeeds(ctx, i.redis, i.metrics, infoHash, trackers)
-			if err != nil {
-				logging.Error().Err(err).Str("info_hash", infoHash).Msg("Failed to get leechers and seeders")
-			}
-
-			title := processTitle(title, magnetAudio)
-
-			// if the number of sizes is equal to the number of magnets, then assign the size to each indexed torrent in order
-			var mySize string
-			if len(size) == len(magnetLinks) {
-				mySize = size[it]
-			}
-			if mySize == "" {
-				go func() {
-					_, _ = i.magnetMetadataAPI.FetchMetadata(ctx, magnetLink)
-				}()
-			}
-
-			ixt := schema.IndexedTorrent{
-				Title:         releaseTitle,
-				OriginalTitle: title,
-				Details:       link,
-				Year:          year,
-				IMDB:          imdbLink,
-				Audio:         magnetAudio,
-				MagnetLink:    magnetLink,
-				Date:          date,
-				InfoHash:      infoHash,
-				Trackers:      trackers,
-				LeechCount:    peer,
-				SeedCount:     seed,
-				Size:          mySize,
-			}
-			chanIndexedTorrent <- ixt
-		}(it, magnetLink)
-	}
-
-	for i := 0; i < len(magnetLinks); i++ {
-		it := <-chanIndexedTorrent
-		indexedTorrents = append(indexedTorrents, it)
+	category := findCategoryFromPost(article, link)
+
+	post := postMetadata{
+		Link:     link,
+		Title:    title,
+		Year:     year,
+		IMDB:     imdbLink,
+		Audio:    audio,
+		Sizes:    size,
+		Date:     date,
+		Category: category,
 	}
 
-	return indexedTorrents, nil
+	return indexMagnetLinks(ctx, i, post, magnetLinks), nil
 }
 
 func getPublishedDate(document *goquery.Document) time.Time {
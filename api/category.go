@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+// categoryPatterns are tried in order, since a post can carry several hints,
+// e.g. an anime is usually also listed under "Séries".
+var categoryPatterns = []struct {
+	category string
+	re       *regexp.Regexp
+}{
+	{schema.CategoryAnime, regexp.MustCompile(`(?i)\banimes?\b`)},
+	{schema.CategoryDocumentary, regexp.MustCompile(`(?i)\b(document[aá]rios?|documentary|documentaries|docu-?s[eé]ries?)\b`)},
+	{schema.CategorySeries, regexp.MustCompile(`(?i)\b(s[eé]ries?|temporadas?|tv ?shows?|novelas?|desenhos?)\b`)},
+	{schema.CategoryMovie, regexp.MustCompile(`(?i)\b(filmes?|movies?)\b`)},
+}
+
+// categoryLinkSelectors find the breadcrumb and category links of a post.
+var categoryLinkSelectors = strings.Join([]string{
+	"a[rel~=\"category\"]",
+	"a[rel~=\"tag\"]",
+	".breadcrumb a",
+	".breadcrumbs a",
+	"[itemtype*=\"BreadcrumbList\"] a",
+}, ", ")
+
+// genreRE matches the "Gênero: Ação | Aventura" line of the posts.
+var genreRE = regexp.MustCompile(`(?i)G[êe]neros?:\s*([^\n]{0,80})`)
+
+// classifyCategory returns the first category matched by the hints, in the
+// order of categoryPatterns, or an empty string if none matches.
+func classifyCategory(hints ...string) string {
+	for _, p := range categoryPatterns {
+		if slices.ContainsFunc(hints, p.re.MatchString) {
+			return p.category
+		}
+	}
+	return ""
+}
+
+// findCategoryFromPost classifies a post using its URL path, and the
+// breadcrumb and category links and the "Gênero" line of its content. Only the
+// content of the post is searched, the menus, sidebars and related posts of
+// the page link to every category.
+func findCategoryFromPost(post *goquery.Selection, link string) string {
+	var hints []string
+
+	if u, err := url.Parse(link); err == nil {
+		hints = append(hints, strings.NewReplacer("/", " ", "-", " ").Replace(u.Path))
+	}
+
+	post.Find(categoryLinkSelectors).Each(func(_ int, s *goquery.Selection) {
+		hints = append(hints, s.Text())
+		if href, ok := s.Attr("href"); ok {
+			if u, err := url.Parse(href); err == nil {
+				hints = append(hints, strings.NewReplacer("/", " ", "-", " ").Replace(u.Path))
+			}
+		}
+	})
+
+	if m := genreRE.FindStringSubmatch(post.Text()); m != nil {
+		hints = append(hints, m[1])
+	}
+
+	return classifyCategory(hints...)
+}
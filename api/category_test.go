@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func Test_findCategoryFromPost(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		link string
+		want string
+	}{
+		{
+			name: "should classify from the url path",
+			link: "https://example.com/series/the-boys-4a-temporada/",
+			want: schema.CategorySeries,
+		},
+		{
+			name: "should classify from category links",
+			html: `<article><a href="https://example.com/category/filmes/" rel="category tag">Filmes</a></article>`,
+			link: "https://example.com/duna-parte-dois/",
+			want: schema.CategoryMovie,
+		},
+		{
+			name: "should give priority to anime over series",
+			html: `<article><div class="breadcrumb"><a href="/">Home</a><a href="/series/">Séries</a><a href="/animes/">Animes</a></div></article>`,
+			link: "https://example.com/one-piece/",
+			want: schema.CategoryAnime,
+		},
+		{
+			name: "should classify from the genre line",
+			html: `<article><p>Gênero: Documentário | História</p></article>`,
+			link: "https://example.com/cosmos/",
+			want: schema.CategoryDocumentary,
+		},
+		{
+			name: "should ignore the links outside the post",
+			html: `<nav><a href="/animes/" rel="category">Animes</a></nav><article><p>Gênero: Ação</p></article><aside><p>Gênero: Documentário</p></aside>`,
+			link: "https://example.com/duna-parte-dois/",
+			want: "",
+		},
+		{
+			name: "should not confuse animation with anime",
+			html: `<article><p>Gênero: Animação | Comédia</p></article>`,
+			link: "https://example.com/divertida-mente-2/",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := findCategoryFromPost(doc.Find("article"), tt.link); got != tt.want {
+				t.Errorf("findCategoryFromPost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddCategory(t *testing.T) {
+	torrents := AddCategory(nil, nil, []schema.IndexedTorrent{
+		{Title: "The.Boys.S04E01.1080p", Season: 4},
+		{Title: "One.Piece.S01E01.1080p", Season: 1, Category: schema.CategoryAnime},
+		{Title: "Duna.Parte.Dois.2024.1080p"},
+	})
+
+	want := []string{schema.CategorySeries, schema.CategoryAnime, schema.CategoryMovie}
+	for i, it := range torrents {
+		if it.Category != want[i] {
+			t.Errorf("AddCategory() [%d] = %v, want %v", i, it.Category, want[i])
+		}
+	}
+}
@@ -2,25 +2,21 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/felipemarinho97/torrent-indexer/logging"
-	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/schema"
-	goscrape "github.com/felipemarinho97/torrent-indexer/scrape"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
 var comando = IndexerMeta{
+	Name:        "comando_torrents",
 	Label:       "comando",
 	URL:         utils.GetIndexerURLFromEnv("INDEXER_COMANDO_URL", "https://comando.la/"),
+	Mirrors:     utils.GetIndexerMirrorsFromEnv("INDEXER_COMANDO_MIRRORS"),
 	SearchURL:   "?s=",
 	PagePattern: "page/%s",
 }
@@ -40,89 +36,25 @@ var replacer = strings.NewReplacer(
 	"dezembro", "12",
 )
 
-func (i *Indexer) HandlerComandoIndexer(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	metadata := comando
+type comandoSite struct{}
 
-	defer func() {
-		i.metrics.IndexerDuration.WithLabelValues(metadata.Label).Observe(time.Since(start).Seconds())
-		i.metrics.IndexerRequests.WithLabelValues(metadata.Label).Inc()
-	}()
-
-	ctx := r.Context()
-	// supported query params: q, season, episode, page, filter_results
-	q := r.URL.Query().Get("q")
-	page := r.URL.Query().Get("page")
-
-	// URL encode query param
-	q = url.QueryEscape(q)
-	url := metadata.URL
-	if q != "" {
-		url = fmt.Sprintf("%s%s%s", url, metadata.SearchURL, q)
-	} else if page != "" {
-		url = fmt.Sprintf(fmt.Sprintf("%s%s", url, metadata.PagePattern), page)
-	}
-
-	logging.InfoWithRequest(r).Str("target_url", url).Msg("Processing indexer request")
-	resp, err := i.requester.GetDocument(ctx, url)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
-	}
-	defer resp.Close()
-
-	doc, err := goquery.NewDocumentFromReader(resp)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
-	}
-
-	var links []string
-	doc.Find("article").Each(func(i int, s *goquery.Selection) {
-		// get link from h2.entry-title > a
-		link, _ := s.Find("h2.entry-title > a").Attr("href")
-		links = append(links, link)
-	})
-
-	// if no links were indexed, expire the document in cache
-	if len(links) == 0 {
-		_ = i.requester.ExpireDocument(ctx, url)
-	}
+func (comandoSite) Meta() IndexerMeta {
+	return comando
+}
 
-	// extract each torrent link
-	indexedTorrents := utils.ParallelFlatMap(links, func(link string) ([]schema.IndexedTorrent, error) {
-		return getTorrents(ctx, i, link, url)
-	})
+func (comandoSite) SearchURL(q, page string) string {
+	return buildSearchURL(comando, q, page)
+}
 
-	// Apply post-processors
-	postProcessedTorrents := indexedTorrents
-	for _, processor := range i.postProcessors {
-		postProcessedTorrents = processor(i, r, postProcessedTorrents)
-	}
+func (comandoSite) ExtractLinks(doc *goquery.Document) []string {
+	return findLinks(doc, "article", "h2.entry-title > a")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(Response{
-		Results:      postProcessedTorrents,
-		Count:        len(postProcessedTorrents),
-		IndexedCount: len(indexedTorrents),
-	})
-	if err != nil {
-		logging.Error().Err(err).Msg("Failed to encode response")
-	}
+func (comandoSite) ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
+	return getTorrents(ctx, i, link, referer)
 }
 
 func getTorrents(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
-	var indexedTorrents []schema.IndexedTorrent
 	doc, err := getDocument(ctx, i, link, referer)
 	if err != nil {
 		return nil, err
@@ -143,12 +75,7 @@ func getTorrents(ctx context.Context, i *Indexer, link, referer string) ([]schem
 		}
 	}
 
-	magnets := textContent.Find("a[href^=\"magnet\"]")
-	var magnetLinks []string
-	magnets.Each(func(i int, s *goquery.Selection) {
-		magnetLink, _ := s.Attr("href")
-		magnetLinks = append(magnetLinks, magnetLink)
-	})
+	magnetLinks := findMagnetLinks(ctx, i, textContent)
 
 	var audio []schema.Audio
 	var year string
@@ -190,66 +117,20 @@ func getTorrents(ctx context.Context, i *Indexer, link, referer string) ([]schem
 		}
 	})
 
-	size = utils.StableUniq(size)
-
-	var chanIndexedTorrent = make(chan schema.IndexedTorrent)
-
-	// for each magnet link, create a new indexed torrent
-	for it, magnetLink := range magnetLinks {
-		it := it
-		go func(it int, magnetLink string) {
-			magnet, err := magnet.ParseMagnetUri(magnetLink)
-			if err != nil {
-				logging.Error().Err(err).Str("magnet_link", magnetLink).Msg("Failed to parse magnet URI")
-			}
-			releaseTitle := magnet.DisplayName
-			infoHash := magnet.InfoHash.String()
-			trackers := magnet.Trackers
-			magnetAudio := getAudioFromTitle(releaseTitle, audio)
-
-			peer, seed, err := goscrape.GetLeechsAndSeeds(ctx, i.redis, i.metrics, infoHash, trackers)
-			if err != nil {
-				logging.Error().Err(err).Str("info_hash", infoHash).Msg("Failed to get leechers and seeders")
-			}
-
-			title := processTitle(title, magnetAudio)
-
-			// if the number of sizes is equal to the number of magnets, then assign the size to each indexed torrent in order
-			var mySize string
-			if len(size) == len(magnetLinks) {
-				mySize = size[it]
-			}
-			if mySize == "" {
-				go func() {
-					_, _ = i.magnetMetadataAPI.FetchMetadata(ctx, magnetLink)
-				}()
-			}
-
-			ixt := schema.IndexedTorrent{
-				Title:         releaseTitle,
-				OriginalTitle: title,
-				Details:       link,
-				Year:          year,
-				IMDB:          imdbLink,
-				Audio:         magnetAudio,
-				MagnetLink:    magnetLink,
-				Date:          date,
-				InfoHash:      infoHash,
-				Trackers:      trackers,
-				LeechCount:    peer,
-				SeedCount:     seed,
-				Size:          mySize,
-			}
-			chanIndexedTorrent <- ixt
-		}(it, magnetLink)
-	}
-
-	for i := 0; i < len(magnetLinks); i++ {
-		it := <-chanIndexedTorrent
-		indexedTorrents = append(indexedTorrents, it)
+	category := findCategoryFromPost(article, link)
+
+	post := postMetadata{
+		Link:     link,
+		Title:    title,
+		Year:     year,
+		IMDB:     imdbLink,
+		Audio:    audio,
+		Sizes:    size,
+		Date:     date,
+		Category: category,
 	}
 
-	return indexedTorrents, nil
+	return indexMagnetLinks(ctx, i, post, magnetLinks), nil
 }
 
 func parseLocalizedDate(datePublished string) (time.Time, error) {
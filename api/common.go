@@ -6,27 +6,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/schema"
+	goscrape "github.com/felipemarinho97/torrent-indexer/scrape"
+	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
 // getDocument retrieves a document from the cache or makes a request to get it.
-// It first checks the Redis cache for the document body.
+// It first checks the Redis cache for the document body, unless the requester
+// bypasses the caches to record or replay the pages.
 func getDocument(ctx context.Context, i *Indexer, link, referer string) (*goquery.Document, error) {
+	bypass := i.requester.BypassesCache()
+
 	// try to get from redis first
-	docCache, err := i.redis.Get(ctx, link)
-	if err == nil {
-		i.metrics.CacheHits.WithLabelValues("document_body").Inc()
-		logging.Debug().Str("url", link).Msg("Returning document from long-lived cache")
-		return goquery.NewDocumentFromReader(io.NopCloser(bytes.NewReader(docCache)))
+	if !bypass {
+		docCache, err := i.redis.Get(ctx, link)
+		if err == nil {
+			i.metrics.CacheHits.WithLabelValues("document_body").Inc()
+			logging.Debug().Str("url", link).Msg("Returning document from long-lived cache")
+			return goquery.NewDocumentFromReader(io.NopCloser(bytes.NewReader(docCache)))
+		}
+		defer i.metrics.CacheMisses.WithLabelValues("document_body").Inc()
 	}
-	defer i.metrics.CacheMisses.WithLabelValues("document_body").Inc()
 
 	resp, err := i.requester.GetDocument(ctx, link, referer)
 	if err != nil {
@@ -40,19 +50,31 @@ func getDocument(ctx context.Context, i *Indexer, link, referer string) (*goquer
 	}
 
 	// set cache
-	err = i.redis.Set(ctx, link, body)
-	if err != nil {
-		logging.Error().Err(err).Str("url", link).Msg("Failed to set document body in redis cache")
+	if !bypass {
+		err = i.redis.Set(ctx, link, body)
+		if err != nil {
+			logging.Error().Err(err).Str("url", link).Msg("Failed to set document body in redis cache")
+		}
 	}
 
 	doc, err := goquery.NewDocumentFromReader(io.NopCloser(bytes.NewReader(body)))
 	if err != nil {
-		return nil, err
+		return nil, parseError{err}
 	}
 
 	return doc, nil
 }
 
+// findMagnetLinks returns the magnet links of the anchors in the selection,
+// decoding the links of the known link protectors.
+func findMagnetLinks(ctx context.Context, i *Indexer, s *goquery.Selection) []string {
+	var hrefs []string
+	s.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		hrefs = append(hrefs, a.AttrOr("href", ""))
+	})
+	return i.resolver.MagnetLinks(ctx, hrefs)
+}
+
 func getPublishedDateFromMeta(document *goquery.Document) time.Time {
 	var date time.Time
 	//<meta property="article:published_time" content="2019-08-23T13:20:57+00:00">
@@ -270,3 +292,110 @@ func getAudioFromTitle(releaseTitle string, audioFromContent []schema.Audio) []s
 
 	return magnetAudio
 }
+
+// postMetadata is the metadata parsed from a post page, shared by all of its magnet links.
+type postMetadata struct {
+	Link     string
+	Title    string
+	Year     string
+	IMDB     string
+	Audio    []schema.Audio
+	Sizes    []string
+	Date     time.Time
+	Category string
+	// DoubleEncoded is set when the names and trackers of the magnet links are escaped twice.
+	DoubleEncoded bool
+	// OriginalTitle builds the original title for the audio of a magnet link, defaults to processTitle.
+	OriginalTitle func(audio []schema.Audio) string
+}
+
+// indexMagnetLinks creates an indexed torrent for each magnet link of a post,
+// scraping the peers of each one concurrently. Invalid magnet links are skipped.
+func indexMagnetLinks(ctx context.Context, i *Indexer, post postMetadata, magnetLinks []string) []schema.IndexedTorrent {
+	sizes := utils.StableUniq(post.Sizes)
+	indexedTorrents := make([]schema.IndexedTorrent, len(magnetLinks))
+
+	var wg sync.WaitGroup
+	for it, magnetLink := range magnetLinks {
+		wg.Add(1)
+		go func(it int, magnetLink string) {
+			defer wg.Done()
+			magnet, err := magnet.ParseMagnetUri(magnetLink)
+			if err != nil {
+				logging.Error().Err(err).Str("magnet_link", magnetLink).Msg("Failed to parse magnet URI")
+				return
+			}
+			releaseTitle := magnet.DisplayName
+			infoHash := magnet.InfoHash.String()
+			trackers := magnet.Trackers
+			if post.DoubleEncoded {
+				releaseTitle, trackers = unescapeMagnet(releaseTitle, trackers)
+			}
+			magnetAudio := getAudioFromTitle(releaseTitle, post.Audio)
+
+			peer, seed, err := goscrape.GetLeechsAndSeeds(ctx, i.redis, i.metrics, infoHash, trackers)
+			if err != nil {
+				logging.Error().Err(err).Str("info_hash", infoHash).Msg("Failed to get leechers and seeders")
+			}
+
+			// if the number of sizes is equal to the number of magnets, then assign the size to each indexed torrent in order
+			var mySize string
+			if len(sizes) == len(magnetLinks) {
+				mySize = sizes[it]
+			}
+			if mySize == "" {
+				go func() {
+					_, _ = i.magnetMetadataAPI.FetchMetadata(ctx, magnetLink)
+				}()
+			}
+
+			indexedTorrents[it] = schema.IndexedTorrent{
+				Title:         releaseTitle,
+				OriginalTitle: originalTitle(post, magnetAudio),
+				Details:       post.Link,
+				Category:      post.Category,
+				Year:          post.Year,
+				IMDB:          post.IMDB,
+				Audio:         magnetAudio,
+				MagnetLink:    magnetLink,
+				Date:          post.Date,
+				InfoHash:      infoHash,
+				Trackers:      trackers,
+				LeechCount:    peer,
+				SeedCount:     seed,
+				Size:          mySize,
+			}
+		}(it, magnetLink)
+	}
+	wg.Wait()
+
+	// Skip empty torrents (failed to parse)
+	return utils.Filter(indexedTorrents, func(it schema.IndexedTorrent) bool {
+		return it.InfoHash != ""
+	})
+}
+
+func originalTitle(post postMetadata, audio []schema.Audio) string {
+	if post.OriginalTitle != nil {
+		return post.OriginalTitle(audio)
+	}
+	return processTitle(post.Title, audio)
+}
+
+// unescapeMagnet decodes the name and trackers of a magnet link that were escaped twice.
+func unescapeMagnet(releaseTitle string, trackers []string) (string, []string) {
+	title, err := url.QueryUnescape(strings.TrimSpace(releaseTitle))
+	if err != nil {
+		logging.Error().Err(err).Str("title", releaseTitle).Msg("Failed to URL decode title")
+		title = strings.TrimSpace(releaseTitle)
+	}
+	unescaped := make([]string, len(trackers))
+	for i, tracker := range trackers {
+		unescapedTracker, err := url.QueryUnescape(tracker)
+		if err != nil {
+			logging.Error().Err(err).Str("tracker", tracker).Msg("Failed to URL decode tracker")
+		}
+		unescaped[i] = strings.TrimSpace(unescapedTracker)
+	}
+	return title, unescaped
+}
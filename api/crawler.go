@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+const (
+	defaultCrawlPages    = 2
+	defaultCrawlInterval = time.Hour
+)
+
+// CrawlerConfig configures the background crawler.
+type CrawlerConfig struct {
+	Pages    int           // number of list pages crawled per site, starting from the home page
+	Interval time.Duration // time between the crawls of a site
+	Jitter   time.Duration // maximum random delay added to each interval, so the sites are not crawled in lockstep
+	// Intervals overrides Interval for some sites, by name.
+	Intervals map[string]time.Duration
+}
+
+// CrawlStatus reports the last crawl of a site.
+type CrawlStatus struct {
+	Name          string     `json:"name"`
+	Interval      string     `json:"interval"`
+	Running       bool       `json:"running"`
+	LastStart     *time.Time `json:"last_start,omitempty"`
+	LastEnd       *time.Time `json:"last_end,omitempty"`
+	LastDuration  string     `json:"last_duration,omitempty"`
+	Pages         int        `json:"pages"`    // list pages fetched in the last crawl
+	Torrents      int        `json:"torrents"` // torrents indexed in the last crawl
+	Errors        int        `json:"errors"`   // pages and posts that failed in the last crawl
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorCode string     `json:"last_error_code,omitempty"`
+	NextCrawl     *time.Time `json:"next_crawl,omitempty"`
+}
+
+// CrawlerStatusResponse is the response of the crawler status endpoint.
+type CrawlerStatusResponse struct {
+	Enabled bool          `json:"enabled"`
+	Sites   []CrawlStatus `json:"sites"`
+}
+
+// Crawler periodically walks the first list pages of every registered site
+// and pushes the torrents to the search index, so the search does not depend
+// on what users happened to query. It is safe for concurrent use.
+type Crawler struct {
+	indexer *Indexer
+	config  CrawlerConfig
+
+	mu     sync.Mutex
+	status map[string]*CrawlStatus
+}
+
+func NewCrawler(i *Indexer, config CrawlerConfig) *Crawler {
+	if config.Pages <= 0 {
+		config.Pages = defaultCrawlPages
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultCrawlInterval
+	}
+	return &Crawler{
+		indexer: i,
+		config:  config,
+		status:  make(map[string]*CrawlStatus),
+	}
+}
+
+// Start crawls each registered site in its own goroutine until the context is done.
+func (c *Crawler) Start(ctx context.Context) {
+	for _, s := range Sites() {
+		go c.run(ctx, s)
+	}
+}
+
+// interval returns the time between the crawls of the site.
+func (c *Crawler) interval(name string) time.Duration {
+	if d, ok := c.config.Intervals[name]; ok && d > 0 {
+		return d
+	}
+	return c.config.Interval
+}
+
+// run crawls the site now and then after every interval, plus jitter.
+func (c *Crawler) run(ctx context.Context, s Site) {
+	name := s.Meta().Name
+	for {
+		c.crawl(ctx, s)
+
+		wait := c.interval(name)
+		if c.config.Jitter > 0 {
+			wait += rand.N(c.config.Jitter)
+		}
+		next := time.Now().Add(wait)
+		c.update(name, func(st *CrawlStatus) { st.NextCrawl = &next })
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// crawl scrapes the first pages of the site. The results go through the
+// post-processors, which send them to the search index.
+func (c *Crawler) crawl(ctx context.Context, s Site) {
+	name := s.Meta().Name
+	start := time.Now()
+	c.update(name, func(st *CrawlStatus) {
+		st.Running = true
+		st.LastStart = &start
+		st.NextCrawl = nil
+	})
+
+	var pages, torrents, errs int
+	var lastErr *IndexingError
+	for page := 1; page <= c.config.Pages && ctx.Err() == nil; page++ {
+		query := url.Values{}
+		if page > 1 {
+			query.Set("page", strconv.Itoa(page))
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/indexers/"+name+"?"+query.Encode(), nil)
+		if err != nil {
+			logging.Error().Err(err).Str("indexer", name).Msg("Failed to build crawl request")
+			break
+		}
+
+		results, postErrors, err := c.indexer.scrape(r, s, nil)
+		if err != nil {
+			ie := newIndexingError(name, "", err)
+			lastErr = &ie
+			errs++
+			logging.Warn().Err(err).Str("indexer", name).Int("page", page).Msg("Failed to crawl indexer page")
+			break
+		}
+		pages++
+		torrents += len(c.indexer.postProcess(r, results))
+		errs += len(postErrors)
+		if len(postErrors) > 0 {
+			lastErr = &postErrors[len(postErrors)-1]
+		}
+	}
+
+	end := time.Now()
+	c.update(name, func(st *CrawlStatus) {
+		st.Running = false
+		st.LastEnd = &end
+		st.LastDuration = end.Sub(start).Round(time.Millisecond).String()
+		st.Pages = pages
+		st.Torrents = torrents
+		st.Errors = errs
+		st.LastError, st.LastErrorCode = "", ""
+		if lastErr != nil {
+			st.LastError, st.LastErrorCode = lastErr.Message, lastErr.Code
+		}
+	})
+	logging.Info().Str("indexer", name).Int("pages", pages).Int("torrents", torrents).Int("errors", errs).
+		Dur("duration", end.Sub(start)).Msg("Crawled indexer")
+}
+
+// update changes the status of the site under the lock.
+func (c *Crawler) update(name string, f func(*CrawlStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.status[name]
+	if !ok {
+		st = &CrawlStatus{Name: name}
+		c.status[name] = st
+	}
+	f(st)
+}
+
+// snapshot returns a copy of the status of the named sites, in order.
+func (c *Crawler) snapshot(names []string) []CrawlStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := make([]CrawlStatus, 0, len(names))
+	for _, name := range names {
+		st := CrawlStatus{Name: name}
+		if s, ok := c.status[name]; ok {
+			st = *s
+		}
+		st.Interval = c.interval(name).String()
+		status = append(status, st)
+	}
+	return status
+}
+
+// HandlerCrawlerStatus reports the last crawl of each registered site.
+// The crawler may be nil when it is disabled.
+func (c *Crawler) HandlerCrawlerStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := CrawlerStatusResponse{Sites: []CrawlStatus{}}
+	if c != nil {
+		resp.Enabled = true
+		resp.Sites = c.snapshot(SiteNames())
+	}
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to encode response")
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Crawler(t *testing.T) {
+	i := newFixtureIndexer(t, filepath.Join("testdata", "sites", "bludv"))
+	site, _ := LookupSite("bludv")
+	c := NewCrawler(i, CrawlerConfig{
+		Pages:     1,
+		Intervals: map[string]time.Duration{"bludv": 10 * time.Minute},
+	})
+
+	c.crawl(context.Background(), site)
+
+	status := c.snapshot([]string{"bludv", "comando_torrents"})
+	if len(status) != 2 {
+		t.Fatalf("snapshot() = %v, want 2 sites", status)
+	}
+	bludv := status[0]
+	if bludv.Running || bludv.LastEnd == nil {
+		t.Errorf("bludv crawl not finished: %+v", bludv)
+	}
+	if bludv.Pages != 1 || bludv.Torrents == 0 || bludv.Errors != 0 {
+		t.Errorf("bludv crawl = %d pages, %d torrents, %d errors, want 1 page with torrents and no errors", bludv.Pages, bludv.Torrents, bludv.Errors)
+	}
+	if bludv.Interval != "10m0s" {
+		t.Errorf("bludv interval = %v, want %v", bludv.Interval, "10m0s")
+	}
+	if comando := status[1]; comando.LastStart != nil || comando.Interval != defaultCrawlInterval.String() {
+		t.Errorf("comando_torrents status = %+v, want never crawled with the default interval", comando)
+	}
+}
+
+func Test_HandlerCrawlerStatusDisabled(t *testing.T) {
+	var c *Crawler
+	w := httptest.NewRecorder()
+	c.HandlerCrawlerStatus(w, httptest.NewRequest("GET", "/crawler/status", nil))
+
+	var resp CrawlerStatusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Enabled || len(resp.Sites) != 0 {
+		t.Errorf("HandlerCrawlerStatus() = %+v, want disabled without sites", resp)
+	}
+}
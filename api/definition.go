@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+// Date sources supported by the site definitions.
+const (
+	DateSourceMeta     = "meta"     // article:published_time, og:updated_time or ld+json
+	DateSourceURL      = "url"      // a date in the post URL, e.g. /movie-18-07-2025/
+	DateSourceSelector = "selector" // the text of an element of the post page
+)
+
+// SiteDefinition describes a WordPress-like site through its URLs and CSS
+// selectors, so that it can be indexed (or fixed after a theme change) by
+// editing a YAML or JSON file instead of shipping a new build.
+type SiteDefinition struct {
+	Name        string   `yaml:"name" json:"name"`
+	Label       string   `yaml:"label" json:"label"`
+	URL         string   `yaml:"url" json:"url"`
+	URLEnv      string   `yaml:"url_env" json:"url_env"`         // environment variable that overrides the URL
+	Mirrors     []string `yaml:"mirrors" json:"mirrors"`         // alternative URLs, tried in order when the URL fails
+	MirrorsEnv  string   `yaml:"mirrors_env" json:"mirrors_env"` // environment variable that overrides the mirrors
+	SearchURL   string   `yaml:"search_url" json:"search_url"`
+	PagePattern string   `yaml:"page_pattern" json:"page_pattern"`
+
+	List ListDefinition `yaml:"list" json:"list"`
+	Post PostDefinition `yaml:"post" json:"post"`
+}
+
+// ListDefinition describes how to find the post links in a list page.
+type ListDefinition struct {
+	Item string `yaml:"item" json:"item"` // e.g. ".post"
+	Link string `yaml:"link" json:"link"` // e.g. "div.title > a", relative to item
+}
+
+// PostDefinition describes how to parse a post page.
+type PostDefinition struct {
+	Container   string         `yaml:"container" json:"container"`       // e.g. "article", defaults to the whole page
+	Title       string         `yaml:"title" json:"title"`               // e.g. ".title > h1", relative to container
+	TitleRemove []string       `yaml:"title_remove" json:"title_remove"` // strings removed from the title, e.g. " - Download"
+	Content     string         `yaml:"content" json:"content"`           // where magnet and IMDB links are, e.g. "div.content", defaults to the container
+	Info        string         `yaml:"info" json:"info"`                 // text blocks with audio, year and size, e.g. "div.content p", defaults to the content paragraphs
+	Date        DateDefinition `yaml:"date" json:"date"`
+}
+
+// DateDefinition describes where the publishing date of a post is.
+type DateDefinition struct {
+	Source   string `yaml:"source" json:"source"`     // meta (default), url or selector
+	Selector string `yaml:"selector" json:"selector"` // used by the selector source
+}
+
+// definitionSite is a Site driven by a SiteDefinition.
+type definitionSite struct {
+	def  SiteDefinition
+	meta IndexerMeta
+}
+
+var (
+	// siteNameRE matches the names that are a single path segment of the routes.
+	siteNameRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// siteLabelRE matches the labels that are valid Prometheus label values, see IndexerMeta.
+	siteLabelRE = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// NewDefinitionSite validates the definition and creates a site from it.
+func NewDefinitionSite(def SiteDefinition) (Site, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	if !siteNameRE.MatchString(def.Name) {
+		return nil, fmt.Errorf("invalid name %q: only letters, digits, dashes and underscores are allowed", def.Name)
+	}
+	if def.URL == "" {
+		return nil, fmt.Errorf("%s: missing url", def.Name)
+	}
+	if def.List.Item == "" || def.List.Link == "" {
+		return nil, fmt.Errorf("%s: missing list.item or list.link selector", def.Name)
+	}
+	if def.Post.Title == "" {
+		return nil, fmt.Errorf("%s: missing post.title selector", def.Name)
+	}
+	switch def.Post.Date.Source {
+	case "":
+		def.Post.Date.Source = DateSourceMeta
+	case DateSourceMeta, DateSourceURL:
+	case DateSourceSelector:
+		if def.Post.Date.Selector == "" {
+			return nil, fmt.Errorf("%s: missing post.date.selector", def.Name)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown date source %q", def.Name, def.Post.Date.Source)
+	}
+
+	if def.Label == "" {
+		def.Label = strings.ReplaceAll(def.Name, "-", "_")
+	}
+	if !siteLabelRE.MatchString(def.Label) {
+		return nil, fmt.Errorf("%s: invalid label %q: only letters, digits and underscores are allowed", def.Name, def.Label)
+	}
+	if def.SearchURL == "" {
+		def.SearchURL = "?s="
+	}
+	if def.PagePattern == "" {
+		def.PagePattern = "page/%s"
+	}
+
+	siteURL := def.URL
+	if def.URLEnv != "" {
+		siteURL = utils.GetIndexerURLFromEnv(def.URLEnv, def.URL)
+	} else if !strings.HasSuffix(siteURL, "/") {
+		siteURL += "/"
+	}
+
+	mirrors := utils.GetIndexerMirrorsFromEnv(def.MirrorsEnv, def.Mirrors...)
+
+	return &definitionSite{
+		def: def,
+		meta: IndexerMeta{
+			Name:        def.Name,
+			Label:       def.Label,
+			URL:         siteURL,
+			Mirrors:     mirrors,
+			SearchURL:   def.SearchURL,
+			PagePattern: def.PagePattern,
+		},
+	}, nil
+}
+
+// LoadSiteDefinitions loads every .yml, .yaml and .json definition in the
+// directory. The files that can not be read or are invalid are logged and
+// skipped, so one bad definition does not disable the others.
+func LoadSiteDefinitions(dir string) ([]Site, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []Site
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml" && ext != ".json") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		site, err := loadSiteDefinition(path)
+		if err != nil {
+			logging.Error().Err(err).Str("file", path).Msg("Skipping site definition")
+			continue
+		}
+		logging.Info().Str("indexer", site.Meta().Name).Str("file", path).Msg("Loaded site definition")
+		loaded = append(loaded, site)
+	}
+
+	return loaded, nil
+}
+
+// loadSiteDefinition reads and validates the definition in the file.
+func loadSiteDefinition(path string) (Site, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so a single decoder handles both formats
+	var def SiteDefinition
+	err = yaml.Unmarshal(content, &def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	site, err := NewDefinitionSite(def)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition %s: %w", path, err)
+	}
+	return site, nil
+}
+
+func (s *definitionSite) Meta() IndexerMeta {
+	return s.meta
+}
+
+func (s *definitionSite) SearchURL(q, page string) string {
+	return buildSearchURL(s.meta, q, page)
+}
+
+func (s *definitionSite) ExtractLinks(doc *goquery.Document) []string {
+	return findLinks(doc, s.def.List.Item, s.def.List.Link)
+}
+
+func (s *definitionSite) ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
+	doc, err := getDocument(ctx, i, link, referer)
+	if err != nil {
+		return nil, err
+	}
+
+	post := s.parsePostMetadata(doc, link)
+
+	magnetLinks := findMagnetLinks(ctx, i, s.content(doc))
+
+	return indexMagnetLinks(ctx, i, post, magnetLinks), nil
+}
+
+// container returns the element holding the post, or the whole page.
+func (s *definitionSite) container(doc *goquery.Document) *goquery.Selection {
+	if s.def.Post.Container == "" {
+		return doc.Selection
+	}
+	return doc.Find(s.def.Post.Container)
+}
+
+// content returns the element holding the magnet and IMDB links.
+func (s *definitionSite) content(doc *goquery.Document) *goquery.Selection {
+	if s.def.Post.Content == "" {
+		return s.container(doc)
+	}
+	return s.container(doc).Find(s.def.Post.Content)
+}
+
+// info returns the text blocks holding the audio, year and size of the post.
+func (s *definitionSite) info(doc *goquery.Document) *goquery.Selection {
+	if s.def.Post.Info == "" {
+		return s.content(doc).Find("p")
+	}
+	return s.container(doc).Find(s.def.Post.Info)
+}
+
+// parsePostMetadata extracts the metadata of the post shared by all its magnet links.
+func (s *definitionSite) parsePostMetadata(doc *goquery.Document, link string) postMetadata {
+	post := postMetadata{Link: link}
+
+	title := strings.TrimSpace(s.container(doc).Find(s.def.Post.Title).First().Text())
+	for _, r := range s.def.Post.TitleRemove {
+		title = strings.ReplaceAll(title, r, "")
+	}
+	post.Title = strings.TrimSpace(title)
+
+	s.info(doc).Each(func(_ int, sel *goquery.Selection) {
+		text := sel.Text()
+		post.Audio = append(post.Audio, findAudioFromText(text)...)
+		if y := findYearFromText(text, post.Title); y != "" {
+			post.Year = y
+		}
+		post.Sizes = append(post.Sizes, findSizesFromText(text)...)
+	})
+	if post.Year == "" {
+		post.Year = findYearFromText("", post.Title)
+	}
+
+	s.content(doc).Find("a").Each(func(_ int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		if imdbLink, err := getIMDBLink(href); err == nil {
+			post.IMDB = imdbLink
+		}
+	})
+
+	post.Date = s.parseDate(doc, link)
+	post.Category = findCategoryFromPost(s.container(doc), link)
+	return post
+}
+
+func (s *definitionSite) parseDate(doc *goquery.Document, link string) time.Time {
+	switch s.def.Post.Date.Source {
+	case DateSourceURL:
+		return getPublishedDateFromRawString(link)
+	case DateSourceSelector:
+		text := strings.TrimSpace(doc.Find(s.def.Post.Date.Selector).First().Text())
+		if date, err := parseLocalizedDate(text); err == nil && !date.IsZero() {
+			return date
+		}
+		return getPublishedDateFromRawString(text)
+	default:
+		return getPublishedDateFromMeta(doc)
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func TestNewDefinitionSite(t *testing.T) {
+	valid := SiteDefinition{
+		Name: "my-site",
+		URL:  "https://my-site.example",
+		List: ListDefinition{Item: ".post", Link: "a"},
+		Post: PostDefinition{Title: "h1"},
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(def *SiteDefinition)
+		wantMeta IndexerMeta
+		wantErr  bool
+	}{
+		{
+			name:   "should apply defaults",
+			modify: func(def *SiteDefinition) {},
+			wantMeta: IndexerMeta{
+				Name:        "my-site",
+				Label:       "my_site",
+				URL:         "https://my-site.example/",
+				SearchURL:   "?s=",
+				PagePattern: "page/%s",
+			},
+		},
+		{
+			name:    "should fail without list selectors",
+			modify:  func(def *SiteDefinition) { def.List.Link = "" },
+			wantErr: true,
+		},
+		{
+			name:    "should fail without date selector",
+			modify:  func(def *SiteDefinition) { def.Post.Date.Source = DateSourceSelector },
+			wantErr: true,
+		},
+		{
+			name:    "should fail on a name that is not a path segment",
+			modify:  func(def *SiteDefinition) { def.Name = "my/site" },
+			wantErr: true,
+		},
+		{
+			name:    "should fail on a label that is not a metric label value",
+			modify:  func(def *SiteDefinition) { def.Label = "my site!" },
+			wantErr: true,
+		},
+		{
+			name:    "should fail on unknown date source",
+			modify:  func(def *SiteDefinition) { def.Post.Date.Source = "header" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := valid
+			tt.modify(&def)
+			got, err := NewDefinitionSite(def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDefinitionSite() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got.Meta(), tt.wantMeta) {
+				t.Errorf("NewDefinitionSite().Meta() = %v, want %v", got.Meta(), tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestLoadSiteDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"yaml-site.yml": `
+name: yaml-site
+url: https://yaml-site.example/
+list:
+  item: .post
+  link: a
+post:
+  title: h1
+`,
+		"json-site.json": `{"name": "json-site", "url": "https://json-site.example/", "list": {"item": ".post", "link": "a"}, "post": {"title": "h1"}}`,
+		"README.md":      "not a definition",
+		"broken.yml":     "name: [broken",
+		"invalid.yml":    "name: invalid/site\nurl: https://invalid.example/\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LoadSiteDefinitions(dir)
+	if err != nil {
+		t.Fatalf("LoadSiteDefinitions() error = %v", err)
+	}
+
+	var names []string
+	for _, s := range got {
+		names = append(names, s.Meta().Name)
+	}
+	want := []string{"json-site", "yaml-site"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("LoadSiteDefinitions() = %v, want %v", names, want)
+	}
+}
+
+func Test_definitionSite_parse(t *testing.T) {
+	site, err := NewDefinitionSite(SiteDefinition{
+		Name: "my-site",
+		URL:  "https://my-site.example/",
+		List: ListDefinition{Item: ".post", Link: "div.title > a"},
+		Post: PostDefinition{
+			Container:   "article",
+			Title:       ".title > h1",
+			TitleRemove: []string{" - Download"},
+			Content:     "div.content",
+			Date:        DateDefinition{Source: DateSourceURL},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := site.(*definitionSite)
+
+	list, _ := goquery.NewDocumentFromReader(strings.NewReader(`
+<div class="post"><div class="title"><a href="https://my-site.example/movie-18-07-2025/">Movie</a></div></div>
+<div class="post"><div class="title"><a href="">Empty</a></div></div>`))
+	links := s.ExtractLinks(list)
+	if want := []string{"https://my-site.example/movie-18-07-2025/"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("ExtractLinks() = %v, want %v", links, want)
+	}
+
+	post, _ := goquery.NewDocumentFromReader(strings.NewReader(`
+<article>
+  <div class="title"><h1>Movie (2025) - Download</h1></div>
+  <div class="content">
+    <p>Áudio: Português, Inglês</p>
+    <p>Tamanho: 2.5 GB</p>
+    <a href="https://www.imdb.com/title/tt1234567/">IMDB</a>
+  </div>
+</article>`))
+	got := s.parsePostMetadata(post, links[0])
+	want := postMetadata{
+		Link:  links[0],
+		Title: "Movie (2025)",
+		Year:  "2025",
+		IMDB:  "https://www.imdb.com/title/tt1234567/",
+		Audio: []schema.Audio{schema.AudioPortuguese, schema.AudioEnglish},
+		Sizes: []string{"2.5 GB"},
+		Date:  time.Date(2025, 7, 18, 0, 0, 0, 0, time.UTC),
+	}
+	want.Category = schema.CategoryMovie
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePostMetadata() = %+v, want %+v", got, want)
+	}
+}
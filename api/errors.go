@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// Error codes reported in the responses. They are stable, so clients can
+// match on them instead of on the messages.
+const (
+	ErrCodeTimeout         = "timeout"            // the site took too long to answer
+	ErrCodeChallenge       = "challenge"          // the site answered with an anti-bot challenge
+	ErrCodeInvalidResponse = "invalid_response"   // the site answered with an empty or non-HTML page
+	ErrCodeFetchFailed     = "fetch_failed"       // the page could not be fetched
+	ErrCodeParseFailed     = "parse_failed"       // the page could not be parsed
+	ErrCodeCircuitOpen     = "circuit_open"       // the site kept failing and is not requested for a while
+	ErrCodeDNS             = "dns_error"          // the host name of the site could not be resolved
+	ErrCodeTLS             = "tls_error"          // the TLS handshake or certificate of the site failed
+	ErrCodeConnRefused     = "connection_refused" // the site refused the connection
+	ErrCodeForbidden       = "forbidden"          // the site answered 403 without a challenge
+	ErrCodeRateLimited     = "rate_limited"       // the site answered 429
+	ErrCodeUnavailable     = "site_unavailable"   // the site answered 503 without a challenge
+	ErrCodeTruncated       = "truncated_response" // the site closed the connection in the middle of the page
+	ErrCodeBadRequest      = "bad_request"        // the request is invalid, e.g. an unknown indexer
+	ErrCodeInternal        = "internal_error"     // the response could not be built
+	ErrCodeAllFailed       = "all_indexers_failed"
+)
+
+// IndexingError describes a page or an indexer that could not be indexed.
+type IndexingError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Indexer string `json:"indexer,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// RetryAfter is the number of seconds the site asked to wait before retrying.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func (e IndexingError) Error() string {
+	return e.Message
+}
+
+// parseError marks an error as a failure to parse a page.
+type parseError struct {
+	err error
+}
+
+func (e parseError) Error() string { return e.err.Error() }
+func (e parseError) Unwrap() error { return e.err }
+
+// newIndexingError describes the error of the indexer when indexing the URL.
+func newIndexingError(indexer, url string, err error) IndexingError {
+	var ie IndexingError
+	if errors.As(err, &ie) {
+		return ie
+	}
+	ie = IndexingError{
+		Code:    errorCode(err),
+		Message: err.Error(),
+		Indexer: indexer,
+		URL:     url,
+	}
+	var fe *requester.FetchError
+	if errors.As(err, &fe) && fe.RetryAfter > 0 {
+		ie.RetryAfter = int(math.Ceil(fe.RetryAfter.Seconds()))
+	}
+	return ie
+}
+
+// errorCode classifies the error into one of the error codes.
+func errorCode(err error) string {
+	var netErr net.Error
+	var pe parseError
+	var fe *requester.FetchError
+	if errors.As(err, &fe) {
+		switch fe.Class {
+		case requester.ClassDNS:
+			return ErrCodeDNS
+		case requester.ClassTLS:
+			return ErrCodeTLS
+		case requester.ClassConnectionRefused:
+			return ErrCodeConnRefused
+		case requester.ClassForbidden:
+			return ErrCodeForbidden
+		case requester.ClassRateLimited:
+			return ErrCodeRateLimited
+		case requester.ClassUnavailable:
+			return ErrCodeUnavailable
+		case requester.ClassTruncated:
+			return ErrCodeTruncated
+		}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrCodeTimeout
+	case errors.Is(err, requester.ErrCircuitOpen):
+		return ErrCodeCircuitOpen
+	case errors.Is(err, requester.ErrChallenge):
+		return ErrCodeChallenge
+	case errors.Is(err, requester.ErrInvalidResponse):
+		return ErrCodeInvalidResponse
+	case errors.As(err, &pe):
+		return ErrCodeParseFailed
+	default:
+		return ErrCodeFetchFailed
+	}
+}
+
+// errorStatus returns the HTTP status for a failure with the error code.
+func errorStatus(code string) int {
+	switch code {
+	case ErrCodeBadRequest:
+		return http.StatusBadRequest
+	case ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrCodeCircuitOpen, ErrCodeRateLimited, ErrCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrCodeChallenge, ErrCodeInvalidResponse, ErrCodeFetchFailed, ErrCodeAllFailed,
+		ErrCodeDNS, ErrCodeTLS, ErrCodeConnRefused, ErrCodeForbidden, ErrCodeTruncated:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes the error as JSON, keeping the "error" message field for
+// compatibility and adding its code.
+func writeError(w http.ResponseWriter, r *http.Request, ie IndexingError) {
+	w.Header().Set("Content-Type", "application/json")
+	if ie.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ie.RetryAfter))
+	}
+	w.WriteHeader(errorStatus(ie.Code))
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"error": ie.Message,
+		"code":  ie.Code,
+	})
+	if err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
+	}
+}
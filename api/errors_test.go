@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+func Test_errorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "should classify deadline as timeout",
+			err:  fmt.Errorf("failed to do request for url https://example.com: %w", context.DeadlineExceeded),
+			want: ErrCodeTimeout,
+		},
+		{
+			name: "should classify challenge",
+			err:  fmt.Errorf("%w for url https://example.com", requester.ErrChallenge),
+			want: ErrCodeChallenge,
+		},
+		{
+			name: "should classify invalid response",
+			err:  fmt.Errorf("%w for url https://example.com", requester.ErrInvalidResponse),
+			want: ErrCodeInvalidResponse,
+		},
+		{
+			name: "should classify open circuit breaker",
+			err:  fmt.Errorf("%w for url https://example.com", requester.ErrCircuitOpen),
+			want: ErrCodeCircuitOpen,
+		},
+		{
+			name: "should classify rate limited",
+			err:  &requester.FetchError{Class: requester.ClassRateLimited, Err: errors.New("rate limited (status 429)")},
+			want: ErrCodeRateLimited,
+		},
+		{
+			name: "should classify parse failure",
+			err:  parseError{errors.New("unexpected EOF")},
+			want: ErrCodeParseFailed,
+		},
+		{
+			name: "should default to fetch failure",
+			err:  errors.New("connection refused"),
+			want: ErrCodeFetchFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err); got != tt.want {
+				t.Errorf("errorCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newIndexingError(t *testing.T) {
+	postErr := newIndexingError("bludv", "https://example.com/post", context.DeadlineExceeded)
+	want := IndexingError{
+		Code:    ErrCodeTimeout,
+		Message: context.DeadlineExceeded.Error(),
+		Indexer: "bludv",
+		URL:     "https://example.com/post",
+	}
+	if postErr != want {
+		t.Errorf("newIndexingError() = %v, want %v", postErr, want)
+	}
+
+	// an already described error keeps its indexer and URL
+	if got := newIndexingError("", "", fmt.Errorf("wrapped: %w", postErr)); got != want {
+		t.Errorf("newIndexingError() = %v, want %v", got, want)
+	}
+}
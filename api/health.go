@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+const (
+	// layoutBrokenThreshold is the number of consecutive list pages without
+	// posts, or of consecutive scrapes whose posts have no torrents, after
+	// which the layout of a site that used to work is flagged as possibly broken.
+	layoutBrokenThreshold = 2
+	// healthSmoothing is the weight of the last scrape in the moving averages.
+	healthSmoothing = 0.2
+)
+
+// IndexerHealth reports the health of an indexer since the process started.
+type IndexerHealth struct {
+	Name                string     `json:"name"`
+	URL                 string     `json:"url,omitempty"` // the base URL the indexer is currently served from
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorCode       string     `json:"last_error_code,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	AvgPostsPerPage     float64    `json:"avg_posts_per_page"`
+	AvgTorrentsPerPost  float64    `json:"avg_torrents_per_post"`
+	// LayoutPossiblyBroken is set when the selectors of a site that used to
+	// find posts and torrents suddenly return nothing, usually after a redesign.
+	LayoutPossiblyBroken bool `json:"layout_possibly_broken"`
+	// Circuit is the state of the circuit breaker of the host the indexer is
+	// currently served from: closed, open or half_open.
+	Circuit requester.CircuitState `json:"circuit,omitempty"`
+
+	emptyPages int // consecutive list pages without posts
+	emptyPosts int // consecutive scrapes whose posts had no torrents
+}
+
+// StatusResponse is the response of the status endpoint.
+type StatusResponse struct {
+	Indexers []IndexerHealth `json:"indexers"`
+	// FlareSolverrCircuit is the state of the circuit breaker of FlareSolverr.
+	FlareSolverrCircuit requester.CircuitState `json:"flaresolverr_circuit"`
+}
+
+// healthTracker keeps the health of each indexer in memory and mirrors it
+// to the Prometheus gauges. It is safe for concurrent use.
+type healthTracker struct {
+	mu       sync.Mutex
+	metrics  *monitoring.Metrics
+	indexers map[string]*IndexerHealth
+}
+
+func newHealthTracker(metrics *monitoring.Metrics) *healthTracker {
+	return &healthTracker{
+		metrics:  metrics,
+		indexers: make(map[string]*IndexerHealth),
+	}
+}
+
+// get returns the health of the indexer, creating it if needed.
+// The caller must hold the lock.
+func (t *healthTracker) get(name string) *IndexerHealth {
+	h, ok := t.indexers[name]
+	if !ok {
+		h = &IndexerHealth{Name: name}
+		t.indexers[name] = h
+	}
+	return h
+}
+
+// recordSuccess records a scrape that fetched the list page.
+// posts is the number of links found in the list page, parsed the number of
+// posts that were parsed without errors and torrents the number of torrents
+// found in them. Empty list pages only count towards a broken layout if browse
+// is set, since a search without results is not a symptom of anything.
+func (t *healthTracker) recordSuccess(meta IndexerMeta, browse bool, posts, parsed, torrents int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(meta.Name)
+	now := time.Now()
+	h.LastSuccess = &now
+	h.ConsecutiveFailures = 0
+
+	if posts > 0 {
+		h.emptyPages = 0
+		h.AvgPostsPerPage = movingAverage(h.AvgPostsPerPage, float64(posts))
+	} else if browse {
+		h.emptyPages++
+	}
+
+	if parsed > 0 {
+		if torrents > 0 {
+			h.emptyPosts = 0
+			h.AvgTorrentsPerPost = movingAverage(h.AvgTorrentsPerPost, float64(torrents)/float64(parsed))
+		} else {
+			h.emptyPosts++
+		}
+	}
+
+	broken := (h.emptyPages >= layoutBrokenThreshold && h.AvgPostsPerPage > 0) ||
+		(h.emptyPosts >= layoutBrokenThreshold && h.AvgTorrentsPerPost > 0)
+	if broken && !h.LayoutPossiblyBroken {
+		logging.Warn().Str("indexer", meta.Name).
+			Int("empty_pages", h.emptyPages).
+			Int("empty_posts", h.emptyPosts).
+			Msg("Indexer selectors stopped matching, layout possibly broken")
+	}
+	h.LayoutPossiblyBroken = broken
+
+	t.observe(meta, h)
+}
+
+// recordFailure records a scrape that could not fetch the list page.
+func (t *healthTracker) recordFailure(meta IndexerMeta, ie IndexingError) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(meta.Name)
+	now := time.Now()
+	h.LastError = ie.Message
+	h.LastErrorCode = ie.Code
+	h.LastErrorAt = &now
+	h.ConsecutiveFailures++
+
+	t.observe(meta, h)
+}
+
+// observe updates the Prometheus gauges of the indexer.
+// The caller must hold the lock.
+func (t *healthTracker) observe(meta IndexerMeta, h *IndexerHealth) {
+	if t.metrics == nil {
+		return
+	}
+	if h.LastSuccess != nil {
+		t.metrics.IndexerLastSuccess.WithLabelValues(meta.Label).Set(float64(h.LastSuccess.Unix()))
+	}
+	t.metrics.IndexerConsecutiveFailures.WithLabelValues(meta.Label).Set(float64(h.ConsecutiveFailures))
+	t.metrics.IndexerPostsPerPage.WithLabelValues(meta.Label).Set(h.AvgPostsPerPage)
+	t.metrics.IndexerTorrentsPerPost.WithLabelValues(meta.Label).Set(h.AvgTorrentsPerPost)
+	layoutBroken := 0.0
+	if h.LayoutPossiblyBroken {
+		layoutBroken = 1
+	}
+	t.metrics.IndexerLayoutBroken.WithLabelValues(meta.Label).Set(layoutBroken)
+}
+
+// snapshot returns a copy of the health of the named indexers, in order.
+// Indexers that were never scraped are reported with zero values.
+func (t *healthTracker) snapshot(names []string) []IndexerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health := make([]IndexerHealth, 0, len(names))
+	for _, name := range names {
+		if h, ok := t.indexers[name]; ok {
+			health = append(health, *h)
+		} else {
+			health = append(health, IndexerHealth{Name: name})
+		}
+	}
+	return health
+}
+
+// handleCircuitState mirrors the state of a circuit breaker to its gauge.
+func (i *Indexer) handleCircuitState(upstream string, state requester.CircuitState) {
+	var value float64
+	switch state {
+	case requester.CircuitClosed:
+		logging.Info().Str("upstream", upstream).Msg("Circuit breaker closed, upstream recovered")
+	case requester.CircuitHalfOpen:
+		value = 1
+	case requester.CircuitOpen:
+		value = 2
+		logging.Warn().Str("upstream", upstream).Msg("Circuit breaker opened, failing requests fast")
+	}
+	i.metrics.CircuitBreakerState.WithLabelValues(upstream).Set(value)
+}
+
+// movingAverage returns the exponential moving average of avg with the new
+// value, or the value itself if there is no average yet.
+func movingAverage(avg, value float64) float64 {
+	if avg == 0 {
+		return value
+	}
+	return avg + healthSmoothing*(value-avg)
+}
+
+// HandlerIndexerStatus reports the health of each registered indexer.
+func (i *Indexer) HandlerIndexerStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	health := i.health.snapshot(SiteNames())
+	for idx := range health {
+		if s, ok := LookupSite(health[idx].Name); ok {
+			health[idx].URL = i.effectiveURL(r.Context(), s)
+			health[idx].Circuit = i.requester.CircuitState(health[idx].URL)
+		}
+	}
+
+	err := json.NewEncoder(w).Encode(StatusResponse{
+		Indexers:            health,
+		FlareSolverrCircuit: i.requester.FlareSolverrCircuitState(),
+	})
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to encode response")
+	}
+}
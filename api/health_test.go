@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"testing"
+)
+
+// scrapeOutcome is a scrape to record in the health tracker.
+// A non-empty code records a failure.
+type scrapeOutcome struct {
+	browse   bool
+	posts    int
+	parsed   int
+	torrents int
+	code     string
+}
+
+func Test_healthTracker(t *testing.T) {
+	tests := []struct {
+		name             string
+		scrapes          []scrapeOutcome
+		wantFailures     int
+		wantBroken       bool
+		wantPostsPerPage float64
+	}{
+		{
+			name: "should not flag a healthy indexer",
+			scrapes: []scrapeOutcome{
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+			},
+			wantPostsPerPage: 20,
+		},
+		{
+			name: "should flag list pages that suddenly have no posts",
+			scrapes: []scrapeOutcome{
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{browse: true},
+				{browse: true},
+			},
+			wantBroken:       true,
+			wantPostsPerPage: 20,
+		},
+		{
+			name: "should flag posts that suddenly have no torrents",
+			scrapes: []scrapeOutcome{
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{browse: true, posts: 20, parsed: 20},
+				{browse: true, posts: 20, parsed: 20},
+			},
+			wantBroken:       true,
+			wantPostsPerPage: 20,
+		},
+		{
+			name: "should not flag searches without results",
+			scrapes: []scrapeOutcome{
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{},
+				{},
+			},
+			wantPostsPerPage: 20,
+		},
+		{
+			name: "should not flag a site that never worked",
+			scrapes: []scrapeOutcome{
+				{browse: true},
+				{browse: true},
+			},
+		},
+		{
+			name: "should recover when posts are found again",
+			scrapes: []scrapeOutcome{
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{browse: true},
+				{browse: true},
+				{browse: true, posts: 10, parsed: 10, torrents: 20},
+			},
+			wantPostsPerPage: 18,
+		},
+		{
+			name: "should count consecutive failures",
+			scrapes: []scrapeOutcome{
+				{code: ErrCodeTimeout},
+				{browse: true, posts: 20, parsed: 20, torrents: 40},
+				{code: ErrCodeChallenge},
+				{code: ErrCodeTimeout},
+			},
+			wantFailures:     2,
+			wantPostsPerPage: 20,
+		},
+	}
+
+	meta := IndexerMeta{Name: "test", Label: "test"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newHealthTracker(nil)
+			for _, s := range tt.scrapes {
+				if s.code != "" {
+					tracker.recordFailure(meta, IndexingError{Code: s.code, Message: "failed"})
+					continue
+				}
+				tracker.recordSuccess(meta, s.browse, s.posts, s.parsed, s.torrents)
+			}
+
+			got := tracker.snapshot([]string{"test"})[0]
+			if got.ConsecutiveFailures != tt.wantFailures {
+				t.Errorf("ConsecutiveFailures = %v, want %v", got.ConsecutiveFailures, tt.wantFailures)
+			}
+			if got.LayoutPossiblyBroken != tt.wantBroken {
+				t.Errorf("LayoutPossiblyBroken = %v, want %v", got.LayoutPossiblyBroken, tt.wantBroken)
+			}
+			if got.AvgPostsPerPage != tt.wantPostsPerPage {
+				t.Errorf("AvgPostsPerPage = %v, want %v", got.AvgPostsPerPage, tt.wantPostsPerPage)
+			}
+		})
+	}
+}
+
+func Test_healthTracker_snapshot(t *testing.T) {
+	tracker := newHealthTracker(nil)
+	tracker.recordFailure(IndexerMeta{Name: "b"}, IndexingError{Code: ErrCodeTimeout, Message: "timed out"})
+
+	got := tracker.snapshot([]string{"a", "b"})
+	if len(got) != 2 {
+		t.Fatalf("snapshot() returned %d indexers, want 2", len(got))
+	}
+	if got[0].Name != "a" || got[0].LastErrorAt != nil || got[0].LastSuccess != nil {
+		t.Errorf("snapshot()[0] = %+v, want zero health of a", got[0])
+	}
+	if got[1].LastErrorCode != ErrCodeTimeout || got[1].LastError != "timed out" || got[1].LastErrorAt == nil {
+		t.Errorf("snapshot()[1] = %+v, want timeout error", got[1])
+	}
+}
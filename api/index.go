@@ -2,39 +2,61 @@ package handler
 
 import (
 	"encoding/json"
+	"maps"
 	"net/http"
 	"time"
 
 	"github.com/felipemarinho97/torrent-indexer/cache"
 	"github.com/felipemarinho97/torrent-indexer/consts"
+	"github.com/felipemarinho97/torrent-indexer/logging"
 	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/monitoring"
 	"github.com/felipemarinho97/torrent-indexer/requester"
+	"github.com/felipemarinho97/torrent-indexer/resolver"
 	"github.com/felipemarinho97/torrent-indexer/schema"
 	meilisearch "github.com/felipemarinho97/torrent-indexer/search"
 )
 
 type Indexer struct {
-	config            IndexersConfig
-	redis             *cache.Redis
-	metrics           *monitoring.Metrics
-	requester         *requester.Requster
-	search            *meilisearch.SearchIndexer
-	magnetMetadataAPI *magnet.MetadataClient
-	postProcessors    []PostProcessorFunc
+	config               IndexersConfig
+	redis                *cache.Redis
+	metrics              *monitoring.Metrics
+	requester            *requester.Requster
+	search               *meilisearch.SearchIndexer
+	magnetMetadataAPI    *magnet.MetadataClient
+	postProcessors       []PostProcessorFunc
+	streamPostProcessors []PostProcessorFunc
+	health               *healthTracker
+	resolver             *resolver.Resolver
+	savedSearches        *savedSearchStore
 }
 
 type IndexerMeta struct {
-	Label       string // Label is used for Prometheus metrics and logging. Must be alphanumeric optionally with underscores.
-	URL         string // URL is the base URL of the indexer, e.g. "https://example.com/"
-	SearchURL   string // SearchURL is the base URL for search queries, e.g. "?s="
-	PagePattern string // PagePattern for pagination, e.g. "page/%s"
+	Name        string   // Name is the public name of the indexer, as used in the URL paths, e.g. "comando_torrents"
+	Label       string   // Label is used for Prometheus metrics and logging. Must be alphanumeric optionally with underscores.
+	URL         string   // URL is the base URL of the indexer, e.g. "https://example.com/"
+	Mirrors     []string // Mirrors are alternative base URLs, tried in order when URL fails, e.g. "https://example.net/"
+	SearchURL   string   // SearchURL is the base URL for search queries, e.g. "?s="
+	PagePattern string   // PagePattern for pagination, e.g. "page/%s"
 }
 
 type Response struct {
 	Results      []schema.IndexedTorrent `json:"results"`
 	Count        int                     `json:"count"`
 	IndexedCount int                     `json:"indexed_count,omitempty"`
+	Indexers     []IndexerStatus         `json:"indexers,omitempty"`
+	// Errors lists the posts and indexers that failed. The results are partial if not empty.
+	Errors []IndexingError `json:"errors,omitempty"`
+}
+
+// IndexerStatus reports the outcome of a single indexer in an aggregated search.
+type IndexerStatus struct {
+	Name      string `json:"name"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Count     int    `json:"count"`
+	LatencyMs int64  `json:"latency_ms"`
 }
 
 type PostProcessorFunc func(*Indexer, *http.Request, []schema.IndexedTorrent) []schema.IndexedTorrent
@@ -44,9 +66,13 @@ var GlobalPostProcessors = []PostProcessorFunc{
 	FullfilMissingMetadata, // Fill missing size or title metadata
 	CleanupTitleWebsites,   // Remove website names from titles
 	FallbackPostTitle,      // Fallback to original title if empty
+	AddSeasonEpisode,       // Parse season and episode from titles
+	AddReleaseInfo,         // Parse resolution, source, codecs and group from titles
+	AddCategory,            // Classify into movie, series, anime or documentary
 	AppendAudioTags,        // Add (brazilian, eng, etc.) audio tags to titles
 	ApplySorting,           // Sort results based on sortBy and sortDirection params
 	SendToSearchIndexer,    // Send indexed torrents to Meilisearch
+	NotifySavedSearches,    // Post new matches of the saved searches to their webhooks
 	FilterBy,               // Filter results based on query params (audio, etc.)
 	ApplyLimit,             // Limit number of results based on query param
 }
@@ -63,14 +89,87 @@ func NewIndexers(
 	si *meilisearch.SearchIndexer,
 	mc *magnet.MetadataClient,
 ) *Indexer {
-	return &Indexer{
-		config:            config,
-		redis:             redis,
-		metrics:           metrics,
-		requester:         req,
-		search:            si,
-		magnetMetadataAPI: mc,
-		postProcessors:    GlobalPostProcessors,
+	i := &Indexer{
+		config:               config,
+		redis:                redis,
+		metrics:              metrics,
+		requester:            req,
+		search:               si,
+		magnetMetadataAPI:    mc,
+		postProcessors:       GlobalPostProcessors,
+		streamPostProcessors: StreamPostProcessors,
+		health:               newHealthTracker(metrics),
+		resolver:             resolver.New(redis, metrics),
+		savedSearches:        newSavedSearchStore(redis),
+	}
+	req.SetDomainMoveHandler(i.handleDomainMove)
+	req.SetDomainMoveVerifier(i.verifyDomainMove)
+	req.SetQueueWaitHandler(func(host string, wait time.Duration) {
+		metrics.RequesterQueueWait.WithLabelValues(host).Observe(wait.Seconds())
+	})
+	req.SetCircuitStateHandler(i.handleCircuitState)
+	return i
+}
+
+// runIndexer runs the indexer for the request and applies the post-processors to the results.
+func (i *Indexer) runIndexer(r *http.Request, s Site) (Response, error) {
+	indexedTorrents, postErrors, err := i.scrape(r, s, nil)
+	if err != nil {
+		return Response{}, err
+	}
+
+	postProcessedTorrents := i.postProcess(r, indexedTorrents)
+	return Response{
+		Results:      postProcessedTorrents,
+		Count:        len(postProcessedTorrents),
+		IndexedCount: len(indexedTorrents),
+		Errors:       postErrors,
+	}, nil
+}
+
+// scrape runs the indexer for the request, recording its metrics, and returns the raw results.
+// If emit is not nil, it receives the results of each post as soon as they are parsed.
+// The errors of the posts that failed are returned along with the results.
+func (i *Indexer) scrape(r *http.Request, s Site, emit func([]schema.IndexedTorrent)) ([]schema.IndexedTorrent, []IndexingError, error) {
+	metadata := s.Meta()
+	start := time.Now()
+	defer func() {
+		i.metrics.IndexerDuration.WithLabelValues(metadata.Label).Observe(time.Since(start).Seconds())
+		i.metrics.IndexerRequests.WithLabelValues(metadata.Label).Inc()
+	}()
+
+	indexedTorrents, postErrors, err := i.searchSite(r, s, emit)
+	if err != nil {
+		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
+		return nil, nil, err
+	}
+	return indexedTorrents, postErrors, nil
+}
+
+// postProcess applies the post-processors to the indexed torrents.
+func (i *Indexer) postProcess(r *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	for _, processor := range i.postProcessors {
+		torrents = processor(i, r, torrents)
+	}
+	return torrents
+}
+
+// serveJSON runs the indexer and writes the results as a JSON Response.
+// The status is 206 if some posts failed and 5xx if the indexer failed.
+func (i *Indexer) serveJSON(w http.ResponseWriter, r *http.Request, s Site) {
+	resp, err := i.runIndexer(r, s)
+	if err != nil {
+		writeError(w, r, newIndexingError(s.Meta().Name, "", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to encode response")
 	}
 }
 
@@ -82,13 +181,22 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 		"page":           "page number",
 		"filter_results": "if results with similarity equals to zero should be filtered (true/false)",
 		"limit":          "maximum number of results to return",
-		"sortBy":         "sort by field (title, original_title, year, date, seed_count, leech_count, size, similarity)",
+		"sortBy":         "sort by field (title, original_title, year, date, seed_count, leech_count, size, resolution, similarity)",
 		"sortDirection":  "sort direction (asc or desc, default: desc)",
 		"audio":          "filter by audio languages (comma separated, e.g. por,eng,brazilian)",
 		"year":           "filter by year (e.g. 2020)",
 		"imdb":           "filter by imdb ID (e.g. tt1234567) - this ONLY FILTERTS results, for searching by IMDB ID use the \"q\" parameter",
+		"cat":            "filter by category (comma separated: movie, series, anime, documentary)",
+		"quality":        "filter by resolution (comma separated, e.g. 1080p,2160p)",
+		"source":         "filter by source (comma separated, e.g. web-dl,bluray)",
+		"codec":          "filter by video codec (comma separated, e.g. x264,x265)",
+		"season":         "filter by season number (e.g. 1)",
+		"ep":             "filter by episode number (e.g. 2), season packs of the requested season are kept",
 	}
 
+	allQueryParams := maps.Clone(commonQueryParams)
+	allQueryParams["indexers"] = "comma separated list of indexers to search (default: all)"
+
 	// Define structs for ordered JSON output
 	type EndpointDetail struct {
 		Method      string                 `json:"method"`
@@ -99,8 +207,16 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 
 	type Endpoints struct {
 		IndexerGeneric []EndpointDetail `json:"/indexers/{indexer_name}"`
+		All            []EndpointDetail `json:"/indexers/all"`
 		Manual         []EndpointDetail `json:"/indexers/manual"`
+		Status         []EndpointDetail `json:"/indexers/status"`
+		RSS            []EndpointDetail `json:"/indexers/{indexer_name}/rss"`
+		AllRSS         []EndpointDetail `json:"/rss"`
+		Torznab        []EndpointDetail `json:"/torznab/{indexer_name}/api"`
 		Search         []EndpointDetail `json:"/search"`
+		CrawlerStatus  []EndpointDetail `json:"/crawler/status"`
+		Backfill       []EndpointDetail `json:"/admin/backfill/{indexer_name}"`
+		SavedSearches  []EndpointDetail `json:"/saved-searches/{id}"`
 		UI             []EndpointDetail `json:"/ui/"`
 	}
 
@@ -114,17 +230,9 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	err := json.NewEncoder(w).Encode(RootResponse{
-		Time:  currentTime,
-		Build: consts.GetBuildInfo(),
-		IndexerNames: []string{
-			"comando_torrents",
-			"bludv",
-			"torrent-dos-filmes",
-			"filme_torrent",
-			"rede_torrent",
-			"vaca_torrent",
-			"starck-filmes",
-		},
+		Time:         currentTime,
+		Build:        consts.GetBuildInfo(),
+		IndexerNames: SiteNames(),
 		Endpoints: Endpoints{
 			IndexerGeneric: []EndpointDetail{
 				{
@@ -133,6 +241,13 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 					QueryParams: commonQueryParams,
 				},
 			},
+			All: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Search all indexers concurrently, merging duplicated results by info hash",
+					QueryParams: allQueryParams,
+				},
+			},
 			Manual: []EndpointDetail{
 				{
 					Method:      "POST",
@@ -146,6 +261,42 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 					Description: "Get all manual torrents",
 				},
 			},
+			Status: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Health of each indexer: last success and error, consecutive failures, average posts per page and torrents per post, and whether the layout is possibly broken",
+				},
+			},
+			RSS: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "RSS 2.0 feed of the latest releases of the specified indexer, for torrent clients auto-download rules",
+					QueryParams: commonQueryParams,
+				},
+			},
+			AllRSS: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "RSS 2.0 feed of the latest releases of all indexers",
+					QueryParams: allQueryParams,
+				},
+			},
+			Torznab: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Torznab API for the specified indexer, to be used directly by Sonarr, Radarr or Prowlarr",
+					QueryParams: map[string]string{
+						"t":      "function to call (caps, search, tvsearch, movie)",
+						"q":      "search query",
+						"season": "season number (tvsearch only)",
+						"ep":     "episode number (tvsearch only)",
+						"imdbid": "IMDB ID (movie only)",
+						"cat":    "comma separated Torznab categories (2000, 5000, 5070, 5080)",
+						"limit":  "maximum number of results to return",
+						"offset": "number of results to skip",
+					},
+				},
+			},
 			Search: []EndpointDetail{
 				{
 					Method:      "GET",
@@ -153,9 +304,57 @@ func HandlerIndex(w http.ResponseWriter, r *http.Request) {
 					QueryParams: map[string]string{
 						"q":     "search query",
 						"limit": "maximum number of results to return (default: 10)",
+						"cat":   "filter by category (comma separated: movie, series, anime, documentary)",
 					},
 				},
 			},
+			CrawlerStatus: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Last crawl of each indexer by the background crawler that feeds the search index",
+				},
+			},
+			Backfill: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Progress of the backfill of the specified indexer, or of all indexers without one",
+				},
+				{
+					Method:      "POST",
+					Description: "Start or resume the backfill of every list page of the specified indexer into the search index",
+					QueryParams: map[string]string{
+						"restart": "start over instead of resuming from the checkpoint (true or false)",
+					},
+				},
+				{
+					Method:      "DELETE",
+					Description: "Stop the backfill of the specified indexer, keeping its checkpoint",
+				},
+			},
+			SavedSearches: []EndpointDetail{
+				{
+					Method:      "GET",
+					Description: "Get the specified saved search, or all saved searches without an ID",
+				},
+				{
+					Method:      "POST",
+					Description: "Create a saved search (without an ID) whose new matches are posted to a webhook once per info hash",
+					Body: map[string]interface{}{
+						"name":        "optional name",
+						"query":       "words that must all be in the title, e.g. The Last of Us 1080p dual",
+						"filters":     "filters of the indexer endpoints, e.g. {\"audio\": \"brazilian\", \"season\": \"2\"}",
+						"webhook_url": "URL that receives a POST with the saved search and its matches",
+					},
+				},
+				{
+					Method:      "PUT",
+					Description: "Replace the specified saved search",
+				},
+				{
+					Method:      "DELETE",
+					Description: "Delete the specified saved search",
+				},
+			},
 			UI: []EndpointDetail{
 				{
 					Method:      "GET",
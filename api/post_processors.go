@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/release"
 	"github.com/felipemarinho97/torrent-indexer/schema"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 	"github.com/hbollon/go-edlib"
@@ -119,6 +120,62 @@ func FallbackPostTitle(i *Indexer, r *http.Request, torrents []schema.IndexedTor
 	return torrents
 }
 
+// AddSeasonEpisode parses the season and episode of each torrent from its title,
+// falling back to the post title.
+func AddSeasonEpisode(_ *Indexer, _ *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	for i, it := range torrents {
+		se := utils.ParseSeasonEpisode(it.Title)
+		if se.Season == 0 {
+			se = utils.ParseSeasonEpisode(it.OriginalTitle)
+		}
+		torrents[i].Season = se.Season
+		torrents[i].Episode = se.Episode
+		torrents[i].EpisodeEnd = se.EpisodeEnd
+		torrents[i].SeasonPack = se.SeasonPack
+	}
+	return torrents
+}
+
+// AddCategory completes the category of each torrent. Releases with season
+// markers are series, unless the post was classified as anime or documentary,
+// and the remaining unclassified ones default to movies.
+func AddCategory(_ *Indexer, _ *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	for i, it := range torrents {
+		if it.Category == "" {
+			torrents[i].Category = classifyCategory(it.Title, it.OriginalTitle)
+		}
+		if it.Season > 0 && (torrents[i].Category == "" || torrents[i].Category == schema.CategoryMovie) {
+			torrents[i].Category = schema.CategorySeries
+		}
+		if torrents[i].Category == "" {
+			torrents[i].Category = schema.CategoryMovie
+		}
+	}
+	return torrents
+}
+
+// AddReleaseInfo parses the resolution, source, codecs and group of each torrent
+// from its title, completing missing fields with the names of its video files.
+func AddReleaseInfo(_ *Indexer, _ *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	for i, it := range torrents {
+		info := release.Parse(it.Title)
+		for _, file := range it.Files {
+			if utils.IsVideoFile(file.Path) {
+				info = info.Merge(release.ParseFile(file.Path))
+			}
+		}
+		torrents[i].Resolution = info.Resolution
+		torrents[i].Source = info.Source
+		torrents[i].VideoCodec = info.VideoCodec
+		torrents[i].HDR = info.HDR
+		torrents[i].DolbyVision = info.DolbyVision
+		torrents[i].AudioCodec = info.AudioCodec
+		torrents[i].AudioChannels = info.AudioChannels
+		torrents[i].ReleaseGroup = info.Group
+	}
+	return torrents
+}
+
 func AddSimilarityCheck(i *Indexer, r *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
 	q := r.URL.Query().Get("q")
 
@@ -207,6 +264,8 @@ func ApplySorting(_ *Indexer, r *http.Request, torrents []schema.IndexedTorrent)
 			} else if iBytes > jBytes {
 				cmp = 1
 			}
+		case "resolution", "quality":
+			cmp = release.ResolutionRank(i.Resolution) - release.ResolutionRank(j.Resolution)
 		case "similarity":
 			if i.Similarity < j.Similarity {
 				cmp = -1
@@ -232,19 +291,18 @@ func FilterBy(_ *Indexer, r *http.Request, torrents []schema.IndexedTorrent) []s
 	audioParam := r.URL.Query().Get("audio")
 	yearParam := r.URL.Query().Get("year")
 	imdbParam := r.URL.Query().Get("imdb")
+	season, _ := strconv.Atoi(r.URL.Query().Get("season"))
+	episode, _ := strconv.Atoi(r.URL.Query().Get("ep"))
 
-	var requestedAudioTags []string
-	if audioParam != "" {
-		parts := strings.Split(audioParam, ",")
-		for _, p := range parts {
-			if t := strings.TrimSpace(strings.ToLower(p)); t != "" {
-				requestedAudioTags = append(requestedAudioTags, t)
-			}
-		}
-	}
+	requestedAudioTags := splitFilterParam(audioParam)
+	requestedQualities := splitFilterParam(r.URL.Query().Get("quality"))
+	requestedSources := splitFilterParam(r.URL.Query().Get("source"))
+	requestedCodecs := splitFilterParam(r.URL.Query().Get("codec"))
+	requestedCategories := splitFilterParam(r.URL.Query().Get("cat"))
 
 	// If no filters are active, return original list
-	if len(requestedAudioTags) == 0 && yearParam == "" && imdbParam == "" {
+	if len(requestedAudioTags) == 0 && yearParam == "" && imdbParam == "" && season <= 0 && episode <= 0 &&
+		len(requestedQualities) == 0 && len(requestedSources) == 0 && len(requestedCodecs) == 0 && len(requestedCategories) == 0 {
 		return torrents
 	}
 
@@ -277,6 +335,52 @@ func FilterBy(_ *Indexer, r *http.Request, torrents []schema.IndexedTorrent) []s
 			}
 		}
 
+		// Filter by category
+		if !matchCategory(it, requestedCategories) {
+			return false
+		}
+
+		// Filter by release info
+		if len(requestedQualities) > 0 && !slices.Contains(requestedQualities, strings.ToLower(it.Resolution)) {
+			return false
+		}
+		if len(requestedSources) > 0 && !slices.Contains(requestedSources, strings.ToLower(it.Source)) {
+			return false
+		}
+		if len(requestedCodecs) > 0 && !slices.Contains(requestedCodecs, strings.ToLower(it.VideoCodec)) {
+			return false
+		}
+
+		// Filter by season and episode, season packs match any of their episodes
+		if season > 0 || episode > 0 {
+			se := utils.SeasonEpisode{
+				Season:     it.Season,
+				Episode:    it.Episode,
+				EpisodeEnd: it.EpisodeEnd,
+				SeasonPack: it.SeasonPack,
+			}
+			if se.Season == 0 || !se.HasEpisode(max(season, 0), max(episode, 0)) {
+				return false
+			}
+		}
+
 		return true
 	})
 }
+
+// matchCategory reports whether the torrent is in one of the categories.
+// An empty list matches every torrent.
+func matchCategory(it schema.IndexedTorrent, categories []string) bool {
+	return len(categories) == 0 || slices.Contains(categories, it.Category)
+}
+
+// splitFilterParam splits a comma separated filter param into lowercase values.
+func splitFilterParam(param string) []string {
+	var values []string
+	for _, p := range strings.Split(param, ",") {
+		if v := strings.TrimSpace(strings.ToLower(p)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func TestFilterBy_seasonEpisode(t *testing.T) {
+	torrents := AddSeasonEpisode(nil, nil, []schema.IndexedTorrent{
+		{Title: "The.Boys.S04E01.1080p"},
+		{Title: "The.Boys.S04E02.1080p"},
+		{Title: "The.Boys.S03E02.1080p"},
+		{Title: "The Boys 1080p", OriginalTitle: "The Boys - 4ª Temporada Completa"},
+		{Title: "Duna Parte Dois (2024)"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "should filter by season",
+			query: "season=4",
+			want:  []string{"The.Boys.S04E01.1080p", "The.Boys.S04E02.1080p", "The Boys 1080p"},
+		},
+		{
+			name:  "should keep season packs when filtering by episode",
+			query: "season=4&ep=2",
+			want:  []string{"The.Boys.S04E02.1080p", "The Boys 1080p"},
+		},
+		{
+			name:  "should not filter without params",
+			query: "",
+			want:  []string{"The.Boys.S04E01.1080p", "The.Boys.S04E02.1080p", "The.Boys.S03E02.1080p", "The Boys 1080p", "Duna Parte Dois (2024)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/indexers/bludv?"+tt.query, nil)
+			var got []string
+			for _, it := range FilterBy(nil, r, torrents) {
+				got = append(got, it.Title)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBy_releaseInfo(t *testing.T) {
+	torrents := AddReleaseInfo(nil, nil, []schema.IndexedTorrent{
+		{Title: "Movie.2024.720p.WEBRip.x264-GRP"},
+		{Title: "Movie.2024.2160p.BluRay.x265-GRP"},
+		{Title: "Movie.2024.1080p.WEB-DL.x265-GRP"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "should filter by quality",
+			query: "quality=1080p,2160p",
+			want:  []string{"Movie.2024.2160p.BluRay.x265-GRP", "Movie.2024.1080p.WEB-DL.x265-GRP"},
+		},
+		{
+			name:  "should filter by source and codec",
+			query: "source=web-dl,webrip&codec=x265",
+			want:  []string{"Movie.2024.1080p.WEB-DL.x265-GRP"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/indexers/bludv?"+tt.query, nil)
+			var got []string
+			for _, it := range FilterBy(nil, r, torrents) {
+				got = append(got, it.Title)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySorting_resolution(t *testing.T) {
+	torrents := AddReleaseInfo(nil, nil, []schema.IndexedTorrent{
+		{Title: "Movie.2024.720p.WEBRip"},
+		{Title: "Movie.2024.2160p.BluRay"},
+		{Title: "Movie.2024.1080p.WEB-DL"},
+	})
+
+	r := httptest.NewRequest("GET", "/indexers/bludv?sortBy=resolution", nil)
+	var got []string
+	for _, it := range ApplySorting(nil, r, torrents) {
+		got = append(got, it.Resolution)
+	}
+	want := []string{"2160p", "1080p", "720p"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplySorting() = %v, want %v", got, want)
+	}
+}
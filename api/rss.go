@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	TorrentNS string     `xml:"xmlns:torrent,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	Comments    string       `xml:"comments,omitempty"`
+	Category    string       `xml:"category,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Torrent     rssTorrent   `xml:"torrent:torrent"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// rssTorrent holds the ezRSS torrent namespace fields, understood by the RSS
+// downloaders of most torrent clients.
+type rssTorrent struct {
+	ContentLength int64  `xml:"torrent:contentLength,omitempty"`
+	InfoHash      string `xml:"torrent:infoHash"`
+	MagnetURI     string `xml:"torrent:magnetURI"`
+}
+
+// HandlerRSS renders the latest releases of an indexer as an RSS 2.0 feed, so
+// torrent clients can subscribe to it with auto-download rules.
+// Without an indexer in the path, the feed aggregates every indexer.
+// The query params of the indexer endpoints (filters, sorting, limit) are supported.
+func (i *Indexer) HandlerRSS(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("indexer")
+	if name == "" {
+		name = allIndexersName
+	}
+
+	run, ok := i.runnerFor(name)
+	if !ok {
+		writeError(w, r, IndexingError{Code: ErrCodeBadRequest, Message: fmt.Sprintf("unknown indexer: %s", name)})
+		return
+	}
+
+	resp, err := run(r)
+	if err != nil && len(resp.Results) == 0 {
+		logging.ErrorWithRequest(r).Err(err).Str("indexer", name).Msg("Failed to run indexer for rss request")
+		writeError(w, r, newIndexingError(name, "", err))
+		return
+	}
+
+	out, err := xml.MarshalIndent(newRSSFeed(name, requestBaseURL(r), resp.Results), "", "  ")
+	if err != nil {
+		writeError(w, r, IndexingError{Code: ErrCodeInternal, Message: err.Error(), Indexer: name})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	_, err = w.Write([]byte(xml.Header))
+	if err == nil {
+		_, err = w.Write(out)
+	}
+	if err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to write rss response")
+	}
+}
+
+func newRSSFeed(name, link string, torrents []schema.IndexedTorrent) rssFeed {
+	items := make([]rssItem, 0, len(torrents))
+	for _, it := range torrents {
+		items = append(items, newRSSItem(it))
+	}
+
+	return rssFeed{
+		Version:   "2.0",
+		TorrentNS: "http://xmlns.ezrss.it/0.1/",
+		Channel: rssChannel{
+			Title:         fmt.Sprintf("torrent-indexer (%s)", name),
+			Link:          link,
+			Description:   "Latest releases indexed from Brazilian torrent websites",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+			Items:         items,
+		},
+	}
+}
+
+func newRSSItem(it schema.IndexedTorrent) rssItem {
+	size := utils.ParseSize(it.Size)
+
+	item := rssItem{
+		Title:       it.Title,
+		Link:        it.MagnetLink,
+		GUID:        rssGUID{Value: it.InfoHash},
+		Description: it.OriginalTitle,
+		Comments:    it.Details,
+		Category:    it.Category,
+		Enclosure: rssEnclosure{
+			URL:    it.MagnetLink,
+			Length: size,
+			Type:   "application/x-bittorrent",
+		},
+		Torrent: rssTorrent{
+			ContentLength: size,
+			InfoHash:      it.InfoHash,
+			MagnetURI:     it.MagnetLink,
+		},
+	}
+
+	if !it.Date.IsZero() {
+		item.PubDate = it.Date.Format(time.RFC1123Z)
+	}
+
+	return item
+}
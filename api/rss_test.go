@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	meilisearch "github.com/felipemarinho97/torrent-indexer/search"
+)
+
+func Test_newRSSFeed(t *testing.T) {
+	torrents := []schema.IndexedTorrent{
+		{
+			Title:         "The.Boys.S01E02.1080p.WEB-DL",
+			OriginalTitle: "The Boys - 1ª Temporada",
+			Details:       "https://example.com/the-boys/",
+			MagnetLink:    "magnet:?xt=urn:btih:e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			InfoHash:      "e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			Date:          time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+			Size:          "1.5 GB",
+			Category:      schema.CategorySeries,
+		},
+	}
+
+	out, err := xml.Marshal(newRSSFeed("bludv", "http://localhost/", torrents))
+	if err != nil {
+		t.Fatalf("xml.Marshal() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">`,
+		`<title>The.Boys.S01E02.1080p.WEB-DL</title>`,
+		`<guid isPermaLink="false">e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c</guid>`,
+		`<pubDate>Thu, 02 Jan 2025 03:04:05 +0000</pubDate>`,
+		`<enclosure url="magnet:?xt=urn:btih:e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c" length="1610612736" type="application/x-bittorrent"></enclosure>`,
+		`<torrent:infoHash>e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c</torrent:infoHash>`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("newRSSFeed() output does not contain %s\n%s", want, out)
+		}
+	}
+}
+
+type refusingTransport struct{}
+
+func (refusingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+}
+
+func Test_HandlerRSS_errors(t *testing.T) {
+	// every site refuses the connection
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(refusingTransport{})
+	i := NewIndexers(IndexersConfig{}, cache.NewMemory(), monitoring.NewMetrics(), req, meilisearch.NewSearchIndexer("", "", "torrents"), nil)
+
+	tests := []struct {
+		indexer    string
+		wantStatus int
+		wantCode   string
+	}{
+		{indexer: "unknown", wantStatus: http.StatusBadRequest, wantCode: ErrCodeBadRequest},
+		{indexer: "bludv", wantStatus: http.StatusBadGateway, wantCode: ErrCodeConnRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.indexer, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/rss/"+tt.indexer, nil)
+			r.SetPathValue("indexer", tt.indexer)
+			w := httptest.NewRecorder()
+			i.HandlerRSS(w, r)
+
+			var body map[string]string
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != tt.wantStatus || body["code"] != tt.wantCode {
+				t.Errorf("HandlerRSS() = %d %q, want %d %q: %s", w.Code, body["code"], tt.wantStatus, tt.wantCode, w.Body)
+			}
+		})
+	}
+}
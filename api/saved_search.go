@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	savedSearchesRedisKey = "savedSearches"
+	// savedSearchNotifiedExpiration is how long a match is remembered, so it
+	// is not notified again when its post is scraped again.
+	savedSearchNotifiedExpiration = 90 * 24 * time.Hour
+	webhookTimeout                = 10 * time.Second
+	// savedSearchQueueSize is how many batches of torrents can wait to be
+	// checked against the saved searches before new ones are dropped.
+	savedSearchQueueSize = 64
+)
+
+// savedSearchFilters are the FilterBy query params a saved search can use.
+var savedSearchFilters = []string{"audio", "year", "imdb", "season", "ep", "quality", "source", "codec", "cat"}
+
+// SavedSearch is a query whose new matches are posted to a webhook.
+type SavedSearch struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Query matches the torrents whose title has every word of it, e.g. "The Last of Us 1080p dual".
+	Query string `json:"query"`
+	// Filters are FilterBy query params, e.g. {"audio": "brazilian", "season": "2"}.
+	Filters    map[string]string `json:"filters,omitempty"`
+	WebhookURL string            `json:"webhook_url"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// SavedSearchNotification is the payload posted to the webhook of a saved search.
+type SavedSearchNotification struct {
+	SavedSearch SavedSearch             `json:"saved_search"`
+	Matches     []schema.IndexedTorrent `json:"matches"`
+}
+
+// validate checks the saved search fields set by the user.
+func (s SavedSearch) validate() error {
+	if strings.TrimSpace(s.Query) == "" && len(s.Filters) == 0 {
+		return errors.New("query or filters are required")
+	}
+	for key := range s.Filters {
+		if !slices.Contains(savedSearchFilters, key) {
+			return fmt.Errorf("unknown filter: %q, supported filters are %s", key, strings.Join(savedSearchFilters, ", "))
+		}
+	}
+	u, err := url.Parse(s.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook_url: %q", s.WebhookURL)
+	}
+	return nil
+}
+
+// match returns the torrents matching the saved search, skipping the ones
+// published before the day it was created.
+func (s SavedSearch) match(torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	since := s.CreatedAt.Truncate(24 * time.Hour)
+	words := titleWords(s.Query)
+	matches := make([]schema.IndexedTorrent, 0)
+	for _, it := range torrents {
+		if it.InfoHash == "" || (!it.Date.IsZero() && it.Date.Before(since)) {
+			continue
+		}
+		title := titleWords(it.Title + " " + it.OriginalTitle)
+		if !containsAll(title, words) {
+			continue
+		}
+		matches = append(matches, it)
+	}
+	if len(matches) == 0 || len(s.Filters) == 0 {
+		return matches
+	}
+
+	// the filters are the ones of the indexer endpoints
+	query := url.Values{}
+	for key, value := range s.Filters {
+		query.Set(key, value)
+	}
+	r := &http.Request{URL: &url.URL{RawQuery: query.Encode()}}
+	return FilterBy(nil, r, matches)
+}
+
+// titleWords splits the text into lowercase words, treating any punctuation
+// (dots, dashes, brackets) as a separator.
+func titleWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func containsAll(words, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(words, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// savedSearchStore keeps the saved searches in Redis and notifies their
+// webhooks of the new matches, in the background. It is safe for concurrent use.
+type savedSearchStore struct {
+	mu     sync.Mutex // serializes the changes to the saved searches
+	redis  *cache.Redis
+	client *http.Client
+	queue  chan []schema.IndexedTorrent
+}
+
+func newSavedSearchStore(c *cache.Redis) *savedSearchStore {
+	st := &savedSearchStore{
+		redis:  c,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan []schema.IndexedTorrent, savedSearchQueueSize),
+	}
+	go st.run()
+	return st
+}
+
+// list returns the saved searches. The caller must hold the lock to change them.
+func (st *savedSearchStore) list(ctx context.Context) ([]SavedSearch, error) {
+	out, err := st.redis.Get(ctx, savedSearchesRedisKey)
+	if errors.Is(err, redis.Nil) {
+		return []SavedSearch{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var searches []SavedSearch
+	if err := json.Unmarshal(out, &searches); err != nil {
+		return nil, fmt.Errorf("failed to parse saved searches: %w", err)
+	}
+	return searches, nil
+}
+
+// save replaces the saved searches. The caller must hold the lock.
+func (st *savedSearchStore) save(ctx context.Context, searches []SavedSearch) error {
+	out, err := json.Marshal(searches)
+	if err != nil {
+		return err
+	}
+	// saved searches never expire
+	return st.redis.SetWithExpiration(ctx, savedSearchesRedisKey, out, 0)
+}
+
+// All returns the saved searches.
+func (st *savedSearchStore) All(ctx context.Context) ([]SavedSearch, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.list(ctx)
+}
+
+// Put creates the saved search if its ID is empty, or replaces the one with
+// its ID. The saved search must have been validated.
+func (st *savedSearchStore) Put(ctx context.Context, s SavedSearch) (SavedSearch, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	searches, err := st.list(ctx)
+	if err != nil {
+		return SavedSearch{}, err
+	}
+
+	if s.ID == "" {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+		s.ID = hex.EncodeToString(id)
+		s.CreatedAt = time.Now()
+		searches = append(searches, s)
+	} else {
+		idx := slices.IndexFunc(searches, func(e SavedSearch) bool { return e.ID == s.ID })
+		if idx < 0 {
+			return SavedSearch{}, errSavedSearchNotFound
+		}
+		s.CreatedAt = searches[idx].CreatedAt
+		searches[idx] = s
+	}
+	return s, st.save(ctx, searches)
+}
+
+var errSavedSearchNotFound = errors.New("saved search not found")
+
+// Delete removes the saved search.
+func (st *savedSearchStore) Delete(ctx context.Context, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	searches, err := st.list(ctx)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(searches, func(e SavedSearch) bool { return e.ID == id })
+	if idx < 0 {
+		return errSavedSearchNotFound
+	}
+	return st.save(ctx, slices.Delete(searches, idx, idx+1))
+}
+
+func notifiedKey(id, infoHash string) string {
+	return fmt.Sprintf("savedSearch:%s:notified:%s", id, infoHash)
+}
+
+// Notify queues the torrents to be checked against the saved searches, so
+// the request indexing them does not wait for Redis or the webhooks. They are
+// dropped if the queue is full.
+func (st *savedSearchStore) Notify(torrents []schema.IndexedTorrent) {
+	select {
+	case st.queue <- torrents:
+	default:
+		logging.Warn().Int("torrents", len(torrents)).Msg("Saved searches queue is full, dropping torrents")
+	}
+}
+
+// run checks the queued torrents against the saved searches.
+func (st *savedSearchStore) run() {
+	for torrents := range st.queue {
+		st.notify(context.Background(), torrents)
+	}
+}
+
+// notify posts the torrents that match each saved search, and were not
+// notified before, to its webhook. The webhooks are called one at a time by
+// the worker, so a slow one fills the queue instead of piling up requests.
+func (st *savedSearchStore) notify(ctx context.Context, torrents []schema.IndexedTorrent) {
+	searches, err := st.list(ctx)
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to load saved searches")
+		return
+	}
+
+	for _, s := range searches {
+		var matches []schema.IndexedTorrent
+		for _, it := range s.match(torrents) {
+			// only the first to mark the match notifies it, even across instances
+			marked, err := st.redis.SetNX(ctx, notifiedKey(s.ID, it.InfoHash), []byte("1"), savedSearchNotifiedExpiration)
+			if err != nil {
+				logging.Error().Err(err).Str("saved_search", s.ID).Msg("Failed to mark saved search match")
+				continue
+			}
+			if marked {
+				matches = append(matches, it)
+			}
+		}
+		if len(matches) > 0 {
+			st.send(s, matches)
+		}
+	}
+}
+
+// send posts the matches to the webhook, forgetting them if it fails so
+// they are notified again next time.
+func (st *savedSearchStore) send(s SavedSearch, matches []schema.IndexedTorrent) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	err := st.post(ctx, s, matches)
+	if err == nil {
+		logging.Info().Str("saved_search", s.ID).Int("matches", len(matches)).Msg("Notified saved search webhook")
+		return
+	}
+	logging.Error().Err(err).Str("saved_search", s.ID).Str("webhook_url", s.WebhookURL).Msg("Failed to notify saved search webhook")
+	for _, it := range matches {
+		_ = st.redis.Del(ctx, notifiedKey(s.ID, it.InfoHash))
+	}
+}
+
+func (st *savedSearchStore) post(ctx context.Context, s SavedSearch, matches []schema.IndexedTorrent) error {
+	body, err := json.Marshal(SavedSearchNotification{SavedSearch: s, Matches: matches})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := st.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NotifySavedSearches posts the new matches of the saved searches to their webhooks
+func NotifySavedSearches(i *Indexer, r *http.Request, torrents []schema.IndexedTorrent) []schema.IndexedTorrent {
+	// the torrents are filtered, and so reordered, by the matching
+	i.savedSearches.Notify(slices.Clone(torrents))
+	return torrents
+}
+
+// HandlerSavedSearches manages the saved searches: GET lists them and POST
+// creates one. With an ID in the path, GET returns it, PUT replaces it and
+// DELETE removes it.
+func (i *Indexer) HandlerSavedSearches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var resp any
+	status := http.StatusOK
+	var err error
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		resp, err = i.savedSearches.All(ctx)
+	case r.Method == http.MethodGet:
+		var searches []SavedSearch
+		searches, err = i.savedSearches.All(ctx)
+		idx := slices.IndexFunc(searches, func(s SavedSearch) bool { return s.ID == id })
+		if err == nil && idx < 0 {
+			err = errSavedSearchNotFound
+		} else if err == nil {
+			resp = searches[idx]
+		}
+	case (r.Method == http.MethodPost && id == "") || (r.Method == http.MethodPut && id != ""):
+		var s SavedSearch
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		s.ID = id
+		if err := s.validate(); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if id == "" {
+			status = http.StatusCreated
+		}
+		resp, err = i.savedSearches.Put(ctx, s)
+	case r.Method == http.MethodDelete && id != "":
+		err = i.savedSearches.Delete(ctx, id)
+		status = http.StatusNoContent
+	default:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if errors.Is(err, errSavedSearchNotFound) {
+		writeJSONError(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to manage saved searches")
+		writeJSONError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if resp == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// writeJSONError writes the error as a JSON object with the status.
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func Test_SavedSearch_match(t *testing.T) {
+	created := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	torrents := []schema.IndexedTorrent{
+		{InfoHash: "a", Title: "The.Last.of.Us.S02E01.1080p.WEB-DL.DUAL.5.1", Resolution: "1080p", Season: 2, Episode: 1, Date: created},
+		{InfoHash: "b", Title: "The.Last.of.Us.S02E01.720p.WEB-DL.DUAL.5.1", Resolution: "720p", Season: 2, Episode: 1, Date: created},
+		{InfoHash: "c", Title: "The Last of Us S01 1080p Dual", Resolution: "1080p", Season: 1, SeasonPack: true, Date: created.AddDate(0, 0, -30)},
+		{InfoHash: "d", Title: "The Last Kingdom 1080p Dual", Resolution: "1080p", Date: created},
+		{InfoHash: "e", Title: "The.Last.of.Us.S02E02.1080p.DUAL", Resolution: "1080p", Season: 2, Episode: 2},
+	}
+
+	tests := []struct {
+		name   string
+		search SavedSearch
+		want   []string
+	}{
+		{
+			name:   "should match every word of the query, skipping older releases",
+			search: SavedSearch{Query: "The Last of Us 1080p dual", CreatedAt: created},
+			want:   []string{"a", "e"},
+		},
+		{
+			name:   "should match the releases of the day it was created",
+			search: SavedSearch{Query: "last of us", CreatedAt: created.Add(5 * time.Hour)},
+			want:   []string{"a", "b", "e"},
+		},
+		{
+			name:   "should apply the filters",
+			search: SavedSearch{Query: "the last of us", Filters: map[string]string{"quality": "1080p", "season": "2", "ep": "1"}, CreatedAt: created},
+			want:   []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, it := range tt.search.match(torrents) {
+				got = append(got, it.InfoHash)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_SavedSearch_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		search  SavedSearch
+		wantErr bool
+	}{
+		{name: "valid", search: SavedSearch{Query: "dune", WebhookURL: "https://example.com/hook"}},
+		{name: "filters only", search: SavedSearch{Filters: map[string]string{"imdb": "tt1160419"}, WebhookURL: "http://example.com/hook"}},
+		{name: "empty", search: SavedSearch{WebhookURL: "https://example.com/hook"}, wantErr: true},
+		{name: "unknown filter", search: SavedSearch{Query: "dune", Filters: map[string]string{"limit": "1"}, WebhookURL: "https://example.com/hook"}, wantErr: true},
+		{name: "invalid webhook", search: SavedSearch{Query: "dune", WebhookURL: "file:///etc/passwd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.search.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// webhookRecorder records the notifications posted to it.
+type webhookRecorder struct {
+	mu            sync.Mutex
+	status        int
+	notifications []SavedSearchNotification
+	received      chan struct{}
+}
+
+func newWebhookRecorder(t *testing.T, status int) (*webhookRecorder, *httptest.Server) {
+	rec := &webhookRecorder{status: status, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n SavedSearchNotification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		rec.mu.Lock()
+		rec.notifications = append(rec.notifications, n)
+		w.WriteHeader(rec.status)
+		rec.mu.Unlock()
+		rec.received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return rec, server
+}
+
+func (rec *webhookRecorder) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-rec.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func Test_savedSearchStore_Notify(t *testing.T) {
+	ctx := context.Background()
+	rec, server := newWebhookRecorder(t, http.StatusOK)
+	st := newSavedSearchStore(cache.NewMemory())
+
+	s, err := st.Put(ctx, SavedSearch{Query: "dune 2160p", WebhookURL: server.URL})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	torrents := []schema.IndexedTorrent{
+		{InfoHash: "a", Title: "Dune.Part.Two.2024.2160p.WEB-DL"},
+		{InfoHash: "b", Title: "Dune.Part.Two.2024.1080p.WEB-DL"},
+	}
+
+	st.Notify(torrents)
+	rec.wait(t)
+	// the same match must not be notified again
+	st.Notify(torrents)
+	torrents = append(torrents, schema.IndexedTorrent{InfoHash: "c", Title: "Dune.1984.2160p.BluRay"})
+	st.Notify(torrents)
+	rec.wait(t)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.notifications) != 2 {
+		t.Fatalf("notifications = %d, want 2", len(rec.notifications))
+	}
+	for idx, want := range []string{"a", "c"} {
+		n := rec.notifications[idx]
+		if n.SavedSearch.ID != s.ID || len(n.Matches) != 1 || n.Matches[0].InfoHash != want {
+			t.Errorf("notification %d = %+v, want match %s of %s", idx, n, want, s.ID)
+		}
+	}
+}
+
+func Test_savedSearchStore_NotifyRetriesFailures(t *testing.T) {
+	ctx := context.Background()
+	rec, server := newWebhookRecorder(t, http.StatusInternalServerError)
+	c := cache.NewMemory()
+	st := newSavedSearchStore(c)
+
+	s, err := st.Put(ctx, SavedSearch{Query: "dune", WebhookURL: server.URL})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	st.Notify([]schema.IndexedTorrent{{InfoHash: "a", Title: "Dune"}})
+	rec.wait(t)
+
+	// the match is forgotten once the failed post returns
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := c.Get(ctx, notifiedKey(s.ID, "a")); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed notification was not forgotten")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_HandlerSavedSearches(t *testing.T) {
+	i := &Indexer{savedSearches: newSavedSearchStore(cache.NewMemory())}
+	do := func(method, id, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/saved-searches/"+id, strings.NewReader(body))
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		i.HandlerSavedSearches(w, r)
+		return w
+	}
+
+	w := do("POST", "", `{"name":"tlou","query":"The Last of Us 1080p dual","webhook_url":"https://example.com/hook"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST status = %v, want %v: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var created SavedSearch
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("POST response = %s, want a saved search with an ID", w.Body)
+	}
+
+	if w := do("POST", "", `{"query":"dune","webhook_url":"ftp://example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("POST invalid status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	w = do("PUT", created.ID, `{"query":"The Last of Us 2160p","webhook_url":"https://example.com/hook"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	w = do("GET", created.ID, "")
+	var got SavedSearch
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	if got.Query != "The Last of Us 2160p" || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("GET = %+v, want the updated query with the original creation time", got)
+	}
+
+	if w := do("DELETE", created.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := do("GET", created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+
+	w = do("GET", "", "")
+	var all []SavedSearch
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || len(all) != 0 {
+		t.Errorf("GET all = %s, want an empty list", w.Body)
+	}
+}
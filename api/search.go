@@ -59,7 +59,8 @@ func (h *MeilisearchHandler) SearchTorrentHandler(w http.ResponseWriter, r *http
 		}
 	}
 
-	results, err := h.Module.SearchTorrent(query, limit)
+	categories := splitFilterParam(r.URL.Query().Get("cat"))
+	results, err := h.Module.SearchTorrent(query, limit, categories...)
 	if err != nil {
 		http.Error(w, "Failed to search torrents", http.StatusInternalServerError)
 		return
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+// Site is a torrent website that can be indexed.
+// The indexing flow is the same for every site: build the list page URL,
+// fetch it, extract the post links and parse each post into torrents.
+type Site interface {
+	// Meta returns the site metadata.
+	Meta() IndexerMeta
+	// SearchURL returns the URL of the list page for the query and page number.
+	// Both may be empty, meaning the home page.
+	SearchURL(q, page string) string
+	// ExtractLinks returns the links of the posts found in a list page.
+	ExtractLinks(doc *goquery.Document) []string
+	// ParsePost parses a post page into indexed torrents.
+	ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error)
+}
+
+// SiteSearcher is implemented by sites whose search results can not be
+// fetched with a plain GET to the SearchURL.
+type SiteSearcher interface {
+	Search(ctx context.Context, i *Indexer, q, page string) (*goquery.Document, error)
+}
+
+// sites is the registry of indexable sites, in the order they are advertised.
+var sites = []Site{
+	comandoSite{},
+	bludvSite{},
+	torrentDosFilmesSite{},
+	redeTorrentSite{},
+	&vacaTorrentSite{},
+	starckFilmesSite{},
+}
+
+// Sites returns the registered sites.
+func Sites() []Site {
+	return sites
+}
+
+// reservedSiteNames are the fixed path segments of the routes, which a site
+// name would shadow or be confused with, e.g. /indexers/status or /rss.
+var reservedSiteNames = []string{
+	allIndexersName, "manual", "status", "rss", "indexers", "torznab", "api",
+	"search", "health", "stats", "crawler", "admin", "backfill", "saved-searches", "ui",
+}
+
+// RegisterSite adds a site to the registry.
+// It must be called before the routes are mounted.
+func RegisterSite(s Site) error {
+	name := s.Meta().Name
+	if name == "" || slices.Contains(reservedSiteNames, name) {
+		return fmt.Errorf("invalid site name: %q", name)
+	}
+	if _, ok := LookupSite(name); ok {
+		return fmt.Errorf("site already registered: %s", name)
+	}
+	sites = append(sites, s)
+	return nil
+}
+
+// lookupSiteByURL returns the registered site with the given base URL.
+func lookupSiteByURL(url string) (Site, bool) {
+	for _, s := range sites {
+		if s.Meta().URL == url {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// LookupSite returns the registered site with the given name.
+func LookupSite(name string) (Site, bool) {
+	for _, s := range sites {
+		if s.Meta().Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// SiteNames returns the names of the registered sites.
+func SiteNames() []string {
+	names := make([]string, 0, len(sites))
+	for _, s := range sites {
+		names = append(names, s.Meta().Name)
+	}
+	return names
+}
+
+// HandlerSite returns the handler of the site. The results are streamed as
+// they are found if the request accepts NDJSON or Server-Sent Events.
+func (i *Indexer) HandlerSite(s Site) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contentType := streamContentType(r); contentType != "" {
+			i.serveStream(w, r, s, contentType)
+			return
+		}
+		i.serveJSON(w, r, s)
+	}
+}
+
+// searchSite fetches the list page of the site for the request query and
+// parses every post linked from it. The post-processors are not applied.
+// The posts that fail are reported in the returned errors, while the error is
+// only returned if the list page itself fails.
+// If emit is not nil, it is called with the torrents of each post as soon as
+// the post is parsed, possibly from several goroutines.
+func (i *Indexer) searchSite(r *http.Request, s Site, emit func([]schema.IndexedTorrent)) ([]schema.IndexedTorrent, []IndexingError, error) {
+	ctx := r.Context()
+	// supported query params: q, page, filter_results (season, ep and the others are handled by the post-processors)
+	q := r.URL.Query().Get("q")
+	page := r.URL.Query().Get("page")
+	name := s.Meta().Name
+
+	targetURL := s.SearchURL(q, page)
+	logging.InfoWithRequest(r).Str("target_url", targetURL).Msg("Processing indexer request")
+
+	var doc *goquery.Document
+	var err error
+	if searcher, ok := s.(SiteSearcher); ok && q != "" {
+		doc, err = searcher.Search(ctx, i, q, page)
+	} else {
+		doc, err = i.getListDocument(ctx, targetURL)
+	}
+	if err != nil {
+		ie := newIndexingError(name, targetURL, err)
+		i.health.recordFailure(s.Meta(), ie)
+		return nil, nil, ie
+	}
+
+	links := s.ExtractLinks(doc)
+
+	// if no links were indexed, expire the document in cache
+	if len(links) == 0 {
+		_ = i.requester.ExpireDocument(ctx, targetURL)
+	}
+
+	// extract each torrent link, collecting the posts that fail
+	var postErrors []IndexingError
+	indexedTorrents := utils.ParallelFlatMap(links, func(link string) ([]schema.IndexedTorrent, error) {
+		torrents, err := s.ParsePost(ctx, i, link, targetURL)
+		if err != nil {
+			return nil, newIndexingError(name, link, err)
+		}
+		// the post may have been served by another mirror, point to the healthy one
+		for idx := range torrents {
+			torrents[idx].Details = i.requester.ResolveMirror(ctx, torrents[idx].Details)
+		}
+		if emit != nil {
+			emit(torrents)
+		}
+		return torrents, nil
+	}, func(err error) {
+		ie := newIndexingError(name, "", err)
+		logging.WarnWithRequest(r).Str("indexer", name).Str("url", ie.URL).Str("code", ie.Code).Msg(ie.Message)
+		postErrors = append(postErrors, ie)
+	})
+
+	i.health.recordSuccess(s.Meta(), q == "", len(links), len(links)-len(postErrors), len(indexedTorrents))
+
+	return indexedTorrents, postErrors, nil
+}
+
+// effectiveURL returns the base URL the site is currently served from,
+// which differs from its URL after a failover or a domain move.
+func (i *Indexer) effectiveURL(ctx context.Context, s Site) string {
+	return i.requester.ResolveMirror(ctx, s.Meta().URL)
+}
+
+// handleDomainMove records a site that moved to a new domain, so its new
+// name is still removed from the titles. The requester only reports the
+// moves it confirmed, and the restored ones once the new domain served a page.
+func (i *Indexer) handleDomainMove(move requester.DomainMove) {
+	s, ok := lookupSiteByURL(move.Primary)
+	if !ok {
+		return
+	}
+	if to, err := url.Parse(move.To); err == nil && to.Hostname() != "" {
+		utils.AddKnownWebsite(to.Hostname())
+	}
+	if move.Restored {
+		return
+	}
+	i.metrics.IndexerDomainMoves.WithLabelValues(s.Meta().Label).Inc()
+}
+
+// verifyDomainMove checks that the domain announced by a "we moved to"
+// banner serves the site, finding posts in its home page.
+func (i *Indexer) verifyDomainMove(ctx context.Context, move requester.DomainMove) bool {
+	s, ok := lookupSiteByURL(move.Primary)
+	if !ok {
+		return false
+	}
+	doc, err := i.getListDocument(ctx, move.To)
+	if err != nil {
+		logging.Debug().Err(err).Str("indexer", s.Meta().Name).Str("to", move.To).Msg("Failed to fetch the domain of a moved banner")
+		return false
+	}
+	return len(s.ExtractLinks(doc)) > 0
+}
+
+// getListDocument fetches a list page through the short-lived cache.
+func (i *Indexer) getListDocument(ctx context.Context, targetURL string) (*goquery.Document, error) {
+	resp, err := i.requester.GetDocument(ctx, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp)
+	if err != nil {
+		return nil, parseError{err}
+	}
+	return doc, nil
+}
+
+// buildSearchURL builds the list page URL giving priority to the search query
+// over the page number.
+func buildSearchURL(metadata IndexerMeta, q, page string) string {
+	// URL encode query param
+	q = url.QueryEscape(q)
+	targetURL := metadata.URL
+	if q != "" {
+		targetURL = fmt.Sprintf("%s%s%s", targetURL, metadata.SearchURL, q)
+	} else if page != "" {
+		targetURL = fmt.Sprintf(fmt.Sprintf("%s%s", targetURL, metadata.PagePattern), page)
+	}
+	return targetURL
+}
+
+// findLinks returns the href of the first anchor matched by linkSelector inside
+// each element matched by itemSelector.
+func findLinks(doc *goquery.Document, itemSelector, linkSelector string) []string {
+	var links []string
+	doc.Find(itemSelector).Each(func(_ int, s *goquery.Selection) {
+		link, exists := s.Find(linkSelector).Attr("href")
+		if exists && strings.TrimSpace(link) != "" {
+			links = append(links, link)
+		}
+	})
+	return links
+}
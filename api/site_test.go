@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestSite_SearchURL(t *testing.T) {
+	tests := []struct {
+		name string
+		site Site
+		q    string
+		page string
+		want string
+	}{
+		{
+			name: "should build search url",
+			site: comandoSite{},
+			q:    "the boys",
+			want: comando.URL + "?s=the+boys",
+		},
+		{
+			name: "should build page url",
+			site: torrentDosFilmesSite{},
+			page: "2",
+			want: torrent_dos_filmes.URL + "category/dublado/page/2",
+		},
+		{
+			name: "should give priority to the search query",
+			site: comandoSite{},
+			q:    "the boys",
+			page: "2",
+			want: comando.URL + "?s=the+boys",
+		},
+		{
+			name: "should build home url without query and page",
+			site: redeTorrentSite{},
+			want: rede_torrent.URL,
+		},
+		{
+			name: "should always build search url on bludv without page",
+			site: bludvSite{},
+			want: bludv.URL + "?s=",
+		},
+		{
+			name: "should give priority to page on bludv",
+			site: bludvSite{},
+			q:    "the boys",
+			page: "2",
+			want: bludv.URL + "page/2",
+		},
+		{
+			name: "should redirect empty search to page 1 on starck-filmes",
+			site: starckFilmesSite{},
+			want: starck_filmes.URL + "page/1",
+		},
+		{
+			name: "should use ajax endpoint for vaca_torrent searches",
+			site: &vacaTorrentSite{},
+			q:    "the boys",
+			want: vacaTorrent.URL + "wp-admin/admin-ajax.php",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.site.SearchURL(tt.q, tt.page); got != tt.want {
+				t.Errorf("SearchURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterSite(t *testing.T) {
+	if err := RegisterSite(bludvSite{}); err == nil {
+		t.Errorf("RegisterSite() should fail for an already registered site")
+	}
+	for _, name := range []string{"all", "status", "rss"} {
+		if err := RegisterSite(&definitionSite{meta: IndexerMeta{Name: name}}); err == nil {
+			t.Errorf("RegisterSite() should fail for the reserved name %q", name)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range SiteNames() {
+		if seen[name] {
+			t.Errorf("site %s is registered twice", name)
+		}
+		seen[name] = true
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	meilisearch "github.com/felipemarinho97/torrent-indexer/search"
+)
+
+// update regenerates the golden files: go test ./api -run Test_sitesGolden -update
+var update = flag.Bool("update", false, "update the golden files of the site parsers")
+
+var fixtureInfoHashRE = regexp.MustCompile(`(?i)btih:([0-9a-f]{40})`)
+
+// fixtureTransport sends every request to the fixture server, whatever the
+// host, keeping the path and query.
+type fixtureTransport struct {
+	server *url.URL
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	req.Host = ""
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// fixtureFile returns the fixture of the URL path: "/" is served by
+// index.html and "/catalog/post/" by catalog_post.html.
+func fixtureFile(path string) string {
+	name := strings.ReplaceAll(strings.Trim(path, "/"), "/", "_")
+	if name == "" {
+		name = "index"
+	}
+	return name + ".html"
+}
+
+// newFixtureServer serves the saved pages of the directory.
+func newFixtureServer(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := os.ReadFile(filepath.Join(dir, fixtureFile(r.URL.Path)))
+		if err != nil {
+			t.Errorf("no fixture for %s: %v", r.URL, err)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFixtureIndexer returns an indexer whose requests are served from the
+// saved pages of the directory, with an in-memory cache. The peers of every
+// info hash in the pages are cached, so the trackers are never scraped.
+func newFixtureIndexer(t *testing.T, dir string) *Indexer {
+	t.Helper()
+	server := newFixtureServer(t, dir)
+	serverURL, _ := url.Parse(server.URL)
+
+	c := cache.NewMemory()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		for _, m := range fixtureInfoHashRE.FindAllSubmatch(content, -1) {
+			peers := []byte(`{"seed":10,"leech":2}`)
+			_ = c.SetWithExpiration(context.Background(), strings.ToLower(string(m[1])), peers, time.Hour)
+		}
+	}
+
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), c, 5*time.Second)
+	req.SetTransport(fixtureTransport{server: serverURL})
+
+	return NewIndexers(
+		IndexersConfig{},
+		c,
+		monitoring.NewMetrics(),
+		req,
+		meilisearch.NewSearchIndexer("", "", "torrents"),
+		nil,
+	)
+}
+
+// Test_sitesGolden runs the home page of each site end to end against its
+// saved pages in testdata/sites and compares the results with testdata/golden.
+func Test_sitesGolden(t *testing.T) {
+	for _, site := range Sites() {
+		name := site.Meta().Name
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join("testdata", "sites", name)
+			if _, err := os.Stat(dir); err != nil {
+				t.Fatalf("missing fixtures for %s: %v", name, err)
+			}
+			i := newFixtureIndexer(t, dir)
+
+			w := httptest.NewRecorder()
+			i.HandlerSite(site)(w, httptest.NewRequest("GET", "/indexers/"+name, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var resp Response
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			// posts and magnets are parsed concurrently
+			slices.SortFunc(resp.Results, func(a, b schema.IndexedTorrent) int {
+				return strings.Compare(a.InfoHash, b.InfoHash)
+			})
+
+			got, err := json.MarshalIndent(resp.Results, "", "  ")
+			if err != nil {
+				t.Fatalf("failed to encode results: %v", err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "golden", name+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file, run with -update to create it: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("results differ from %s, run with -update if the change is expected\n%s", golden, diffLines(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// diffLines returns the first lines that differ between want and got.
+func diffLines(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var diff strings.Builder
+	for idx := 0; idx < max(len(wantLines), len(gotLines)) && diff.Len() < 2000; idx++ {
+		var w, g string
+		if idx < len(wantLines) {
+			w = wantLines[idx]
+		}
+		if idx < len(gotLines) {
+			g = gotLines[idx]
+		}
+		if w != g {
+			fmt.Fprintf(&diff, "line %d:\n- %s\n+ %s\n", idx+1, w, g)
+		}
+	}
+	return diff.String()
+}
@@ -2,117 +2,46 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/url"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 
-	"github.com/felipemarinho97/torrent-indexer/logging"
-	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/schema"
-	goscrape "github.com/felipemarinho97/torrent-indexer/scrape"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
 var starck_filmes = IndexerMeta{
+	Name:        "starck-filmes",
 	Label:       "starck_filmes",
 	URL:         utils.GetIndexerURLFromEnv("INDEXER_STARCK_FILMES_URL", "https://www.starckfilmes.fans/"),
+	Mirrors:     utils.GetIndexerMirrorsFromEnv("INDEXER_STARCK_FILMES_MIRRORS"),
 	SearchURL:   "?s=",
 	PagePattern: "page/%s",
 }
 
-func (i *Indexer) HandlerStarckFilmesIndexer(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	metadata := starck_filmes
-
-	defer func() {
-		i.metrics.IndexerDuration.WithLabelValues(metadata.Label).Observe(time.Since(start).Seconds())
-		i.metrics.IndexerRequests.WithLabelValues(metadata.Label).Inc()
-	}()
-
-	ctx := r.Context()
-	// supported query params: q, page, filter_results
-	q := r.URL.Query().Get("q")
-	page := r.URL.Query().Get("page")
-
-	// URL encode query param
-	q = url.QueryEscape(q)
-	url := metadata.URL
-	if q != "" {
-		url = fmt.Sprintf("%s%s%s", url, metadata.SearchURL, q)
-	} else if page != "" {
-		url = fmt.Sprintf(fmt.Sprintf("%s%s", url, metadata.PagePattern), page)
-	}
-
-	// if search is empty, redirect to page 1
-	if q == "" {
-		url = fmt.Sprintf(fmt.Sprintf("%s%s", url, metadata.PagePattern), "1")
-	}
-
-	logging.InfoWithRequest(r).Str("target_url", url).Msg("Processing indexer request")
-	resp, err := i.requester.GetDocument(ctx, url)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
-	}
-	defer resp.Close()
+type starckFilmesSite struct{}
 
-	doc, err := goquery.NewDocumentFromReader(resp)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
-	}
-
-	var links []string
-	doc.Find(".item").Each(func(i int, s *goquery.Selection) {
-		link, _ := s.Find("div.sub-item > a").Attr("href")
-		links = append(links, link)
-	})
+func (starckFilmesSite) Meta() IndexerMeta {
+	return starck_filmes
+}
 
-	// if no links were indexed, expire the document in cache
-	if len(links) == 0 {
-		_ = i.requester.ExpireDocument(ctx, url)
+func (starckFilmesSite) SearchURL(q, page string) string {
+	// the home page has no posts, so redirect empty searches to page 1
+	if q == "" && page == "" {
+		page = "1"
 	}
+	return buildSearchURL(starck_filmes, q, page)
+}
 
-	// extract each torrent link
-	indexedTorrents := utils.ParallelFlatMap(links, func(link string) ([]schema.IndexedTorrent, error) {
-		return getTorrentStarckFilmes(ctx, i, link, url)
-	})
-
-	// Apply post-processors
-	postProcessedTorrents := indexedTorrents
-	for _, processor := range i.postProcessors {
-		postProcessedTorrents = processor(i, r, postProcessedTorrents)
-	}
+func (starckFilmesSite) ExtractLinks(doc *goquery.Document) []string {
+	return findLinks(doc, ".item", "div.sub-item > a")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(Response{
-		Results:      postProcessedTorrents,
-		Count:        len(postProcessedTorrents),
-		IndexedCount: len(indexedTorrents),
-	})
-	if err != nil {
-		logging.Error().Err(err).Msg("Failed to encode response")
-	}
+func (starckFilmesSite) ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
+	return getTorrentStarckFilmes(ctx, i, link, referer)
 }
 
 func getTorrentStarckFilmes(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
-	var indexedTorrents []schema.IndexedTorrent
 	doc, err := getDocument(ctx, i, link, referer)
 	if err != nil {
 		return nil, err
@@ -124,12 +53,7 @@ func getTorrentStarckFilmes(ctx context.Context, i *Indexer, link, referer strin
 	capa := post.Find(".capa")
 	title := capa.Find(".post-description > h2").Text()
 	post_buttons := post.Find(".post-buttons")
-	magnets := post_buttons.Find("a[href^=\"magnet\"]")
-	var magnetLinks []string
-	magnets.Each(func(i int, s *goquery.Selection) {
-		magnetLink, _ := s.Attr("href")
-		magnetLinks = append(magnetLinks, magnetLink)
-	})
+	magnetLinks := findMagnetLinks(ctx, i, post_buttons)
 
 	var audio []schema.Audio
 	var year string
@@ -162,77 +86,19 @@ func getTorrentStarckFilmes(ctx context.Context, i *Indexer, link, referer strin
 	// TODO: find any link from imdb
 	imdbLink := ""
 
-	size = utils.StableUniq(size)
-
-	var chanIndexedTorrent = make(chan schema.IndexedTorrent)
-
-	// for each magnet link, create a new indexed torrent
-	for it, magnetLink := range magnetLinks {
-		it := it
-		go func(it int, magnetLink string) {
-			magnet, err := magnet.ParseMagnetUri(magnetLink)
-			if err != nil {
-				logging.Error().Err(err).Str("magnet_link", magnetLink).Msg("Failed to parse magnet URI")
-			}
-			releaseTitle := strings.TrimSpace(magnet.DisplayName)
-			// url decode the title
-			releaseTitle, err = url.QueryUnescape(releaseTitle)
-			if err != nil {
-				logging.Error().Err(err).Str("title", releaseTitle).Msg("Failed to URL decode title")
-				releaseTitle = strings.TrimSpace(magnet.DisplayName)
-			}
-			infoHash := magnet.InfoHash.String()
-			trackers := magnet.Trackers
-			for i, tracker := range trackers {
-				unescapedTracker, err := url.QueryUnescape(tracker)
-				if err != nil {
-					logging.Error().Err(err).Str("tracker", tracker).Msg("Failed to URL decode tracker")
-				}
-				trackers[i] = strings.TrimSpace(unescapedTracker)
-			}
-			magnetAudio := getAudioFromTitle(releaseTitle, audio)
-
-			peer, seed, err := goscrape.GetLeechsAndSeeds(ctx, i.redis, i.metrics, infoHash, trackers)
-			if err != nil {
-				logging.Error().Err(err).Str("info_hash", infoHash).Msg("Failed to get leechers and seeders")
-			}
-
-			title := processTitle(title, magnetAudio)
-
-			// if the number of sizes is equal to the number of magnets, then assign the size to each indexed torrent in order
-			var mySize string
-			if len(size) == len(magnetLinks) {
-				mySize = size[it]
-			}
-			if mySize == "" {
-				go func() {
-					_, _ = i.magnetMetadataAPI.FetchMetadata(ctx, magnetLink)
-				}()
-			}
-
-			ixt := schema.IndexedTorrent{
-				Title:         releaseTitle,
-				OriginalTitle: title,
-				Details:       link,
-				Year:          year,
-				IMDB:          imdbLink,
-				Audio:         magnetAudio,
-				MagnetLink:    magnetLink,
-				Date:          date,
-				InfoHash:      infoHash,
-				Trackers:      trackers,
-				LeechCount:    peer,
-				SeedCount:     seed,
-				Size:          mySize,
-			}
-			chanIndexedTorrent <- ixt
-		}(it, magnetLink)
-	}
-
-	for i := 0; i < len(magnetLinks); i++ {
-		it := <-chanIndexedTorrent
-		indexedTorrents = append(indexedTorrents, it)
+	category := findCategoryFromPost(post, link)
+
+	metadata := postMetadata{
+		Link:          link,
+		Title:         title,
+		Year:          year,
+		IMDB:          imdbLink,
+		Audio:         audio,
+		Sizes:         size,
+		Date:          date,
+		Category:      category,
+		DoubleEncoded: true,
 	}
 
-	return indexedTorrents, nil
+	return indexMagnetLinks(ctx, i, metadata, magnetLinks), nil
 }
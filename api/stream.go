@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+// Content types of the streaming responses.
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeSSE    = "text/event-stream"
+)
+
+// StreamPostProcessors are applied to the torrents of each post as soon as it
+// is parsed when streaming. The post-processors that need the whole result set
+// (sorting and limit) are left out; the limit is applied by the stream itself.
+var StreamPostProcessors = withoutPostProcessors(GlobalPostProcessors, ApplySorting, ApplyLimit)
+
+// withoutPostProcessors returns the post-processors, in order, except the excluded ones.
+func withoutPostProcessors(processors []PostProcessorFunc, excluded ...PostProcessorFunc) []PostProcessorFunc {
+	return slices.DeleteFunc(slices.Clone(processors), func(p PostProcessorFunc) bool {
+		return slices.ContainsFunc(excluded, func(e PostProcessorFunc) bool {
+			return reflect.ValueOf(p).Pointer() == reflect.ValueOf(e).Pointer()
+		})
+	})
+}
+
+// StreamSummary is the last event of a streaming response.
+type StreamSummary struct {
+	Count        int             `json:"count"`
+	IndexedCount int             `json:"indexed_count"`
+	Indexers     []IndexerStatus `json:"indexers,omitempty"`
+	Errors       []IndexingError `json:"errors,omitempty"`
+}
+
+// streamEvent is a line of a NDJSON response.
+type streamEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// resultStream writes the results as they are found, as NDJSON lines or
+// Server-Sent Events. It is safe for concurrent use.
+type resultStream struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	contentType string
+	limit       int
+	seen        map[string]bool
+	summary     StreamSummary
+}
+
+// streamContentType returns the streaming content type accepted by the
+// request, or an empty string if it does not accept streaming.
+func streamContentType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, contentTypeNDJSON):
+		return contentTypeNDJSON
+	case strings.Contains(accept, contentTypeSSE):
+		return contentTypeSSE
+	default:
+		return ""
+	}
+}
+
+func newResultStream(w http.ResponseWriter, r *http.Request, contentType string) *resultStream {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering, e.g. nginx
+	w.WriteHeader(http.StatusOK)
+
+	s := &resultStream{
+		w:           w,
+		rc:          http.NewResponseController(w),
+		contentType: contentType,
+		limit:       limit,
+		seen:        make(map[string]bool),
+	}
+	_ = s.rc.Flush()
+	return s
+}
+
+// emit post-processes the torrents of a post and writes the ones not sent yet.
+func (i *Indexer) emit(r *http.Request, s *resultStream, torrents []schema.IndexedTorrent) {
+	indexedCount := len(torrents)
+	for _, processor := range i.streamPostProcessors {
+		torrents = processor(i, r, torrents)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.IndexedCount += indexedCount
+	for _, it := range torrents {
+		if s.limit > 0 && s.summary.Count >= s.limit {
+			return
+		}
+		if key := strings.ToLower(it.InfoHash); key != "" {
+			if s.seen[key] {
+				continue
+			}
+			s.seen[key] = true
+		}
+
+		if err := s.write("result", it); err != nil {
+			logging.ErrorWithRequest(r).Err(err).Msg("Failed to write streaming result")
+			return
+		}
+		s.summary.Count++
+	}
+}
+
+// finish writes the summary event.
+func (s *resultStream) finish(r *http.Request, statuses []IndexerStatus, errs []IndexingError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.Indexers = statuses
+	s.summary.Errors = errs
+	if err := s.write("summary", s.summary); err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to write streaming summary")
+	}
+}
+
+// write writes and flushes a single event. The caller must hold the lock.
+func (s *resultStream) write(event string, data interface{}) error {
+	var err error
+	if s.contentType == contentTypeSSE {
+		var payload []byte
+		payload, err = json.Marshal(data)
+		if err == nil {
+			_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+		}
+	} else {
+		err = json.NewEncoder(s.w).Encode(streamEvent{Event: event, Data: data})
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// serveStream runs the site and streams its results.
+func (i *Indexer) serveStream(w http.ResponseWriter, r *http.Request, site Site, contentType string) {
+	s := newResultStream(w, r, contentType)
+	_, errs, err := i.scrape(r, site, func(torrents []schema.IndexedTorrent) {
+		i.emit(r, s, torrents)
+	})
+	if err != nil {
+		errs = append(errs, newIndexingError(site.Meta().Name, "", err))
+	}
+	s.finish(r, nil, errs)
+}
+
+// serveAllStream runs the named indexers concurrently and streams their
+// results, skipping the info hashes already sent.
+func (i *Indexer) serveAllStream(w http.ResponseWriter, r *http.Request, names []string, contentType string) {
+	s := newResultStream(w, r, contentType)
+	statuses, _, errs := i.scrapeIndexers(r, names, func(torrents []schema.IndexedTorrent) {
+		i.emit(r, s, torrents)
+	})
+	s.finish(r, statuses, errs)
+}
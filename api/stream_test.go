@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func Test_resultStream(t *testing.T) {
+	batches := [][]schema.IndexedTorrent{
+		{{Title: "first", InfoHash: "AAAA"}, {Title: "second", InfoHash: "bbbb"}},
+		{{Title: "duplicated", InfoHash: "aaaa"}, {Title: "third", InfoHash: "cccc"}},
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		query  string
+		want   []string
+	}{
+		{
+			name:   "should stream ndjson skipping duplicates",
+			accept: contentTypeNDJSON,
+			want: []string{
+				`{"event":"result","data":{"title":"first"`,
+				`{"event":"result","data":{"title":"second"`,
+				`{"event":"result","data":{"title":"third"`,
+				`{"event":"summary","data":{"count":3,"indexed_count":4}}`,
+			},
+		},
+		{
+			name:   "should stream server-sent events up to the limit",
+			accept: contentTypeSSE,
+			query:  "?limit=1",
+			want: []string{
+				"event: result\ndata: {\"title\":\"first\"",
+				"event: summary\ndata: {\"count\":1,\"indexed_count\":4}\n\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Indexer{}
+			r := httptest.NewRequest("GET", "/indexers/bludv"+tt.query, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			contentType := streamContentType(r)
+			s := newResultStream(w, r, contentType)
+			for _, batch := range batches {
+				i.emit(r, s, batch)
+			}
+			s.finish(r, nil, nil)
+
+			if got := w.Header().Get("Content-Type"); got != tt.accept {
+				t.Errorf("Content-Type = %v, want %v", got, tt.accept)
+			}
+			body := w.Body.String()
+			if strings.Contains(body, "duplicated") {
+				t.Errorf("stream should skip duplicated info hashes\n%s", body)
+			}
+			last := 0
+			for _, want := range tt.want {
+				idx := strings.Index(body[last:], want)
+				if idx < 0 {
+					t.Fatalf("stream does not contain %q in order\n%s", want, body)
+				}
+				last += idx + len(want)
+			}
+			if tt.accept == contentTypeNDJSON && strings.Count(body, "\n") != len(tt.want) {
+				t.Errorf("stream should have one event per line\n%s", body)
+			}
+		})
+	}
+}
+
+func Test_StreamPostProcessors(t *testing.T) {
+	if got, want := len(StreamPostProcessors), len(GlobalPostProcessors)-2; got != want {
+		t.Fatalf("len(StreamPostProcessors) = %d, want %d", got, want)
+	}
+	for _, p := range StreamPostProcessors {
+		if name := runtime.FuncForPC(reflect.ValueOf(p).Pointer()).Name(); strings.HasSuffix(name, ".ApplySorting") || strings.HasSuffix(name, ".ApplyLimit") {
+			t.Errorf("StreamPostProcessors contains %s", name)
+		}
+	}
+}
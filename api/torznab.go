@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/schema"
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+// Torznab error codes, as defined by the newznab/torznab specification.
+const (
+	torznabErrIncorrectParameter   = 201
+	torznabErrNoSuchFunction       = 202
+	torznabErrFunctionNotAvailable = 203
+	torznabErrUnknown              = 900
+)
+
+// Torznab categories used by this indexer.
+const (
+	torznabCategoryMovies      = 2000
+	torznabCategoryTV          = 5000
+	torznabCategoryAnime       = 5070
+	torznabCategoryDocumentary = 5080
+)
+
+const torznabMaxLimit = 100
+
+// torznabCategories maps the indexer categories to the Torznab ones.
+var torznabCategories = map[string]int{
+	schema.CategoryMovie:       torznabCategoryMovies,
+	schema.CategorySeries:      torznabCategoryTV,
+	schema.CategoryAnime:       torznabCategoryAnime,
+	schema.CategoryDocumentary: torznabCategoryDocumentary,
+}
+
+type torznabCaps struct {
+	XMLName    xml.Name          `xml:"caps"`
+	Server     torznabServer     `xml:"server"`
+	Limits     torznabLimits     `xml:"limits"`
+	Searching  torznabSearching  `xml:"searching"`
+	Categories []torznabCategory `xml:"categories>category"`
+}
+
+type torznabServer struct {
+	Title   string `xml:"title,attr"`
+	Version string `xml:"version,attr,omitempty"`
+}
+
+type torznabLimits struct {
+	Max     int `xml:"max,attr"`
+	Default int `xml:"default,attr"`
+}
+
+type torznabSearching struct {
+	Search      torznabSearchMode `xml:"search"`
+	TVSearch    torznabSearchMode `xml:"tv-search"`
+	MovieSearch torznabSearchMode `xml:"movie-search"`
+}
+
+type torznabSearchMode struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+type torznabCategory struct {
+	ID      int               `xml:"id,attr"`
+	Name    string            `xml:"name,attr"`
+	Subcats []torznabCategory `xml:"subcat,omitempty"`
+}
+
+type torznabRSS struct {
+	XMLName   xml.Name       `xml:"rss"`
+	Version   string         `xml:"version,attr"`
+	AtomNS    string         `xml:"xmlns:atom,attr"`
+	TorznabNS string         `xml:"xmlns:torznab,attr"`
+	Channel   torznabChannel `xml:"channel"`
+}
+
+type torznabChannel struct {
+	Title       string        `xml:"title"`
+	Description string        `xml:"description"`
+	Link        string        `xml:"link"`
+	Response    torznabOffset `xml:"torznab:response"`
+	Items       []torznabItem `xml:"item"`
+}
+
+type torznabOffset struct {
+	Offset int `xml:"offset,attr"`
+	Total  int `xml:"total,attr"`
+}
+
+type torznabItem struct {
+	Title       string           `xml:"title"`
+	GUID        string           `xml:"guid"`
+	Link        string           `xml:"link"`
+	Comments    string           `xml:"comments,omitempty"`
+	PubDate     string           `xml:"pubDate,omitempty"`
+	Size        int64            `xml:"size"`
+	Description string           `xml:"description,omitempty"`
+	Category    int              `xml:"category"`
+	Enclosure   torznabEnclosure `xml:"enclosure"`
+	Attrs       []torznabAttr    `xml:"torznab:attr"`
+}
+
+type torznabEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type torznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+// HandlerTorznab exposes the indexers through the Torznab API, so that
+// Sonarr, Radarr and Prowlarr can use them without Jackett in the middle.
+// Supported functions: caps, search, tvsearch and movie.
+// The "all" indexer aggregates the results of every registered indexer.
+func (i *Indexer) HandlerTorznab(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("indexer")
+	run, ok := i.runnerFor(name)
+	if !ok {
+		writeTorznabError(w, r, torznabErrIncorrectParameter, fmt.Sprintf("unknown indexer: %s", name))
+		return
+	}
+
+	switch t := r.URL.Query().Get("t"); t {
+	case "caps":
+		writeTorznabXML(w, r, newTorznabCaps(name))
+	case "search", "tvsearch", "movie":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset < 0 {
+			offset = 0
+		}
+
+		// the indexer runs without a limit, so the total counts every match
+		ir := r.Clone(r.Context())
+		ir.URL.RawQuery = torznabToIndexerQuery(r.URL.Query()).Encode()
+
+		resp, err := run(ir)
+		if err != nil {
+			logging.ErrorWithRequest(r).Err(err).Str("indexer", name).Msg("Failed to run indexer for torznab request")
+			writeTorznabError(w, r, torznabErrUnknown, err.Error())
+			return
+		}
+
+		total := len(resp.Results)
+		results := resp.Results[min(offset, total):min(offset+torznabLimit(r.URL.Query()), total)]
+
+		writeTorznabXML(w, r, newTorznabRSS(name, requestBaseURL(r), offset, total, results))
+	case "":
+		writeTorznabError(w, r, torznabErrNoSuchFunction, "missing parameter: t")
+	default:
+		writeTorznabError(w, r, torznabErrFunctionNotAvailable, fmt.Sprintf("function not available: %s", t))
+	}
+}
+
+// torznabToIndexerQuery translates the Torznab query parameters into the ones
+// understood by the indexer endpoints.
+func torznabToIndexerQuery(params url.Values) url.Values {
+	values := url.Values{}
+	values.Set("filter_results", "true")
+
+	q := strings.TrimSpace(params.Get("q"))
+	if imdbID := params.Get("imdbid"); imdbID != "" {
+		if !strings.HasPrefix(imdbID, "tt") {
+			imdbID = "tt" + imdbID
+		}
+		values.Set("imdb", imdbID)
+		if q == "" {
+			q = imdbID
+		}
+	}
+	if q != "" {
+		values.Set("q", q)
+	}
+
+	for _, p := range []string{"season", "ep", "indexers"} {
+		if v := params.Get(p); v != "" {
+			values.Set(p, v)
+		}
+	}
+	if cat := torznabToIndexerCategories(params.Get("cat")); cat != "" {
+		values.Set("cat", cat)
+	}
+
+	return values
+}
+
+// torznabLimit returns the number of results requested, capped to torznabMaxLimit.
+func torznabLimit(params url.Values) int {
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 || limit > torznabMaxLimit {
+		return torznabMaxLimit
+	}
+	return limit
+}
+
+// torznabToIndexerCategories translates a comma separated list of Torznab
+// categories into the indexer ones. Parent categories include their children.
+func torznabToIndexerCategories(cat string) string {
+	var categories []string
+	add := func(c ...string) {
+		for _, v := range c {
+			if !slices.Contains(categories, v) {
+				categories = append(categories, v)
+			}
+		}
+	}
+
+	for _, v := range strings.Split(cat, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		switch {
+		case id == torznabCategoryTV:
+			add(schema.CategorySeries, schema.CategoryAnime, schema.CategoryDocumentary)
+		case id == torznabCategoryAnime:
+			add(schema.CategoryAnime)
+		case id == torznabCategoryDocumentary:
+			add(schema.CategoryDocumentary)
+		case id > torznabCategoryTV && id < torznabCategoryTV+1000:
+			add(schema.CategorySeries)
+		case id >= torznabCategoryMovies && id < torznabCategoryMovies+1000:
+			add(schema.CategoryMovie)
+		}
+	}
+
+	return strings.Join(categories, ",")
+}
+
+func newTorznabCaps(name string) torznabCaps {
+	return torznabCaps{
+		Server: torznabServer{Title: fmt.Sprintf("torrent-indexer (%s)", name)},
+		Limits: torznabLimits{Max: torznabMaxLimit, Default: torznabMaxLimit},
+		Searching: torznabSearching{
+			Search:      torznabSearchMode{Available: "yes", SupportedParams: "q"},
+			TVSearch:    torznabSearchMode{Available: "yes", SupportedParams: "q,season,ep"},
+			MovieSearch: torznabSearchMode{Available: "yes", SupportedParams: "q,imdbid"},
+		},
+		Categories: []torznabCategory{
+			{ID: torznabCategoryMovies, Name: "Movies"},
+			{ID: torznabCategoryTV, Name: "TV", Subcats: []torznabCategory{
+				{ID: torznabCategoryAnime, Name: "TV/Anime"},
+				{ID: torznabCategoryDocumentary, Name: "TV/Documentary"},
+			}},
+		},
+	}
+}
+
+func newTorznabRSS(name, link string, offset, total int, torrents []schema.IndexedTorrent) torznabRSS {
+	items := make([]torznabItem, 0, len(torrents))
+	for _, it := range torrents {
+		items = append(items, newTorznabItem(it))
+	}
+
+	return torznabRSS{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		TorznabNS: "http://torznab.com/schemas/2015/feed",
+		Channel: torznabChannel{
+			Title:       fmt.Sprintf("torrent-indexer (%s)", name),
+			Description: "Indexing Brazilian Torrent websites into structured data",
+			Link:        link,
+			Response:    torznabOffset{Offset: offset, Total: total},
+			Items:       items,
+		},
+	}
+}
+
+func newTorznabItem(it schema.IndexedTorrent) torznabItem {
+	size := utils.ParseSize(it.Size)
+	category := getTorznabCategory(it)
+
+	item := torznabItem{
+		Title:       it.Title,
+		GUID:        it.InfoHash,
+		Link:        it.MagnetLink,
+		Comments:    it.Details,
+		Size:        size,
+		Description: it.OriginalTitle,
+		Category:    category,
+		Enclosure: torznabEnclosure{
+			URL:    it.MagnetLink,
+			Length: size,
+			Type:   "application/x-bittorrent",
+		},
+		Attrs: []torznabAttr{
+			{Name: "category", Value: strconv.Itoa(category)},
+			{Name: "seeders", Value: strconv.Itoa(it.SeedCount)},
+			{Name: "peers", Value: strconv.Itoa(it.SeedCount + it.LeechCount)},
+			{Name: "infohash", Value: it.InfoHash},
+			{Name: "magneturl", Value: it.MagnetLink},
+			{Name: "size", Value: strconv.FormatInt(size, 10)},
+			{Name: "downloadvolumefactor", Value: "0"},
+			{Name: "uploadvolumefactor", Value: "1"},
+		},
+	}
+
+	if !it.Date.IsZero() {
+		item.PubDate = it.Date.Format(time.RFC1123Z)
+	}
+
+	if matches := imdbLinkRE.FindStringSubmatch(it.IMDB); len(matches) > 2 {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "imdbid", Value: matches[2]})
+	}
+	if it.Season > 0 {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "season", Value: strconv.Itoa(it.Season)})
+	}
+	if it.Episode > 0 {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "episode", Value: strconv.Itoa(it.Episode)})
+	}
+
+	return item
+}
+
+// getTorznabCategory returns the Torznab category of the torrent, defaulting to movies.
+func getTorznabCategory(it schema.IndexedTorrent) int {
+	if category, ok := torznabCategories[it.Category]; ok {
+		return category
+	}
+	return torznabCategoryMovies
+}
+
+// requestBaseURL returns the scheme and host the request was made to.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/", scheme, r.Host)
+}
+
+func writeTorznabXML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	_, err = w.Write([]byte(xml.Header))
+	if err == nil {
+		_, err = w.Write(out)
+	}
+	if err != nil {
+		logging.ErrorWithRequest(r).Err(err).Msg("Failed to write torznab response")
+	}
+}
+
+func writeTorznabError(w http.ResponseWriter, r *http.Request, code int, description string) {
+	writeTorznabXML(w, r, torznabError{Code: code, Description: description})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/schema"
+)
+
+func Test_torznabToIndexerQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		params url.Values
+		want   url.Values
+	}{
+		{
+			name:   "should map a plain search",
+			params: url.Values{"t": {"search"}, "q": {"the boys"}, "limit": {"50"}},
+			want:   url.Values{"filter_results": {"true"}, "q": {"the boys"}},
+		},
+		{
+			name:   "should use imdbid as query and filter when q is empty",
+			params: url.Values{"t": {"movie"}, "imdbid": {"1234567"}},
+			want:   url.Values{"filter_results": {"true"}, "q": {"tt1234567"}, "imdb": {"tt1234567"}},
+		},
+		{
+			name:   "should pass season and episode but not the limit",
+			params: url.Values{"t": {"tvsearch"}, "q": {"the boys"}, "season": {"1"}, "ep": {"2"}, "limit": {"10"}, "offset": {"20"}},
+			want:   url.Values{"filter_results": {"true"}, "q": {"the boys"}, "season": {"1"}, "ep": {"2"}},
+		},
+		{
+			name:   "should map torznab categories, including the children of TV",
+			params: url.Values{"t": {"tvsearch"}, "cat": {"5000,5040,2000"}},
+			want:   url.Values{"filter_results": {"true"}, "cat": {"series,anime,documentary,movie"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := torznabToIndexerQuery(tt.params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("torznabToIndexerQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_HandlerTorznab_total(t *testing.T) {
+	i := newFixtureIndexer(t, filepath.Join("testdata", "sites", "bludv"))
+
+	r := httptest.NewRequest("GET", "/torznab/bludv/api?t=search&limit=1&offset=1", nil)
+	r.SetPathValue("indexer", "bludv")
+	w := httptest.NewRecorder()
+	i.HandlerTorznab(w, r)
+
+	var rss struct {
+		Response struct {
+			Offset int `xml:"offset,attr"`
+			Total  int `xml:"total,attr"`
+		} `xml:"channel>response"`
+		Items []struct{} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v\n%s", err, w.Body)
+	}
+	if len(rss.Items) != 1 || rss.Response.Offset != 1 || rss.Response.Total <= 2 {
+		t.Errorf("HandlerTorznab() = %d items at offset %d of %d, want 1 item at offset 1 of all the matches", len(rss.Items), rss.Response.Offset, rss.Response.Total)
+	}
+}
+
+func Test_newTorznabRSS(t *testing.T) {
+	torrents := []schema.IndexedTorrent{
+		{
+			Title:         "The.Boys.S01E02.1080p.WEB-DL",
+			OriginalTitle: "The Boys - 1ª Temporada",
+			Details:       "https://example.com/the-boys/",
+			IMDB:          "https://www.imdb.com/title/tt1190634/",
+			MagnetLink:    "magnet:?xt=urn:btih:e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			InfoHash:      "e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c",
+			Date:          time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+			Size:          "1.5 GB",
+			SeedCount:     10,
+			LeechCount:    5,
+			Category:      schema.CategorySeries,
+		},
+	}
+
+	out, err := xml.Marshal(newTorznabRSS("bludv", "http://localhost/", 0, 1, torrents))
+	if err != nil {
+		t.Fatalf("xml.Marshal() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`xmlns:torznab="http://torznab.com/schemas/2015/feed"`,
+		`<category>5000</category>`,
+		`<torznab:attr name="seeders" value="10"></torznab:attr>`,
+		`<torznab:attr name="peers" value="15"></torznab:attr>`,
+		`<torznab:attr name="infohash" value="e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c"></torznab:attr>`,
+		`<torznab:attr name="size" value="1610612736"></torznab:attr>`,
+		`<torznab:attr name="imdbid" value="tt1190634"></torznab:attr>`,
+		`<pubDate>Thu, 02 Jan 2025 03:04:05 +0000</pubDate>`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("newTorznabRSS() output does not contain %s\n%s", want, out)
+		}
+	}
+}
@@ -6,144 +6,58 @@ import (
 	"encoding/json"
 	"fmt"
 	"html"
-	"io"
 	"mime/multipart"
 	"net/http"
-	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/felipemarinho97/torrent-indexer/logging"
-	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/schema"
-	goscrape "github.com/felipemarinho97/torrent-indexer/scrape"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
 var vacaTorrent = IndexerMeta{
+	Name:        "vaca_torrent",
 	Label:       "vaca_torrent",
 	URL:         utils.GetIndexerURLFromEnv("INDEXER_VACA_TORRENT_URL", "https://vacatorrentmov.com/"),
+	Mirrors:     utils.GetIndexerMirrorsFromEnv("INDEXER_VACA_TORRENT_MIRRORS"),
 	SearchURL:   "wp-admin/admin-ajax.php",
 	PagePattern: "page/%s",
 }
 
-func (i *Indexer) HandlerVacaTorrentIndexer(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	metadata := vacaTorrent
+type vacaTorrentSite struct{}
 
-	defer func() {
-		i.metrics.IndexerDuration.WithLabelValues(metadata.Label).Observe(time.Since(start).Seconds())
-		i.metrics.IndexerRequests.WithLabelValues(metadata.Label).Inc()
-	}()
-
-	ctx := r.Context()
-	// supported query params: q, season, episode, page, filter_results
-	q := r.URL.Query().Get("q")
-	page := r.URL.Query().Get("page")
-
-	if page == "" {
-		page = "1"
-	}
-
-	var doc *goquery.Document
-	var err error
-	var targetURL string
+func (*vacaTorrentSite) Meta() IndexerMeta {
+	return vacaTorrent
+}
 
+func (*vacaTorrentSite) SearchURL(q, page string) string {
 	if q != "" {
-		// Perform POST request to WordPress AJAX endpoint
-		targetURL = fmt.Sprintf("%s%s", metadata.URL, metadata.SearchURL)
-		doc, err = postSearchVacaTorrent(ctx, i, targetURL, q, page)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			if err != nil {
-				logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-			}
-			i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-			return
-		}
-	} else {
-		// For home page or pagination
-		targetURL = metadata.URL
-		if page != "" && page != "1" {
-			targetURL = fmt.Sprintf(fmt.Sprintf("%s%s", targetURL, metadata.PagePattern), page)
-		}
-
-		logging.InfoWithRequest(r).Str("target_url", targetURL).Msg("Processing indexer request")
-		resp, err := i.requester.GetDocument(ctx, targetURL)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			if err != nil {
-				logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-			}
-			i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-			return
-		}
-		defer resp.Close()
-
-		doc, err = goquery.NewDocumentFromReader(resp)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			if err != nil {
-				logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-			}
-			i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-			return
-		}
+		// searches are made through a POST to the WordPress AJAX endpoint
+		return fmt.Sprintf("%s%s", vacaTorrent.URL, vacaTorrent.SearchURL)
 	}
-
-	var links []string
-
-	// For home page: find article links in .grid-home
-	selector := ".i-tem_ht"
-	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
-		link, exists := s.Find("a").Attr("href")
-		if exists {
-			links = append(links, link)
-		}
-	})
-
-	// if no links were indexed, expire the document in cache
-	if len(links) == 0 {
-		_ = i.requester.ExpireDocument(ctx, targetURL)
+	// For home page or pagination
+	if page != "" && page != "1" {
+		return fmt.Sprintf(fmt.Sprintf("%s%s", vacaTorrent.URL, vacaTorrent.PagePattern), page)
 	}
+	return vacaTorrent.URL
+}
 
-	soraFetcher, err := utils.NewSoraLinkFetcher("https://vacadb.org", i.redis)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		if err != nil {
-			logging.ErrorWithRequest(r).Err(err).Msg("Failed to encode error response")
-		}
-		i.metrics.IndexerErrors.WithLabelValues(metadata.Label).Inc()
-		return
+func (s *vacaTorrentSite) Search(ctx context.Context, i *Indexer, q, page string) (*goquery.Document, error) {
+	if page == "" {
+		page = "1"
 	}
+	return postSearchVacaTorrent(ctx, i, s.SearchURL(q, page), q, page)
+}
 
-	// extract each torrent link
-	indexedTorrents := utils.ParallelFlatMap(links, func(link string) ([]schema.IndexedTorrent, error) {
-		return getTorrentsVacaTorrent(ctx, i, link, targetURL, soraFetcher)
-	})
-
-	// Apply post-processors
-	postProcessedTorrents := indexedTorrents
-	for _, processor := range i.postProcessors {
-		postProcessedTorrents = processor(i, r, postProcessedTorrents)
-	}
+func (*vacaTorrentSite) ExtractLinks(doc *goquery.Document) []string {
+	return findLinks(doc, ".i-tem_ht", "a")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(Response{
-		Results:      postProcessedTorrents,
-		Count:        len(postProcessedTorrents),
-		IndexedCount: len(indexedTorrents),
-	})
-	if err != nil {
-		logging.Error().Err(err).Msg("Failed to encode response")
-	}
+func (*vacaTorrentSite) ParsePost(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
+	return getTorrentsVacaTorrent(ctx, i, link, referer)
 }
 
 // VacaTorrentAjaxResponse represents the JSON response from the WordPress AJAX endpoint
@@ -162,6 +76,8 @@ func postSearchVacaTorrent(ctx context.Context, i *Indexer, targetURL, query, pa
 	// Create multipart form data
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
+	// a fixed boundary keeps the request body, and so its archive entry, stable
+	_ = writer.SetBoundary("torrent-indexer-search")
 
 	// Add form fields
 	_ = writer.WriteField("action", "filtrar_busca")
@@ -189,17 +105,7 @@ func postSearchVacaTorrent(ctx context.Context, i *Indexer, targetURL, query, pa
 	req.Header.Set("Referer", fmt.Sprintf("https://vacatorrentmov.com/?s=%s&lang=en-US", query))
 
 	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := i.requester.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -223,8 +129,7 @@ func postSearchVacaTorrent(ctx context.Context, i *Indexer, targetURL, query, pa
 	return doc, nil
 }
 
-func getTorrentsVacaTorrent(ctx context.Context, i *Indexer, link, referer string, soraFetcher *utils.SoraLinkFetcher) ([]schema.IndexedTorrent, error) {
-	var indexedTorrents []schema.IndexedTorrent
+func getTorrentsVacaTorrent(ctx context.Context, i *Indexer, link, referer string) ([]schema.IndexedTorrent, error) {
 	doc, err := getDocument(ctx, i, link, referer)
 	if err != nil {
 		return nil, err
@@ -297,96 +202,26 @@ func getTorrentsVacaTorrent(ctx context.Context, i *Indexer, link, referer strin
 		date = time.Date(yearInt, date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
 	}
 
-	// Extract magnet links
-	var magnetLinks []string
-	doc.Find("a[href^=\"magnet\"]").Each(func(_ int, s *goquery.Selection) {
-		magnetLink, _ := s.Attr("href")
-		magnetLinks = append(magnetLinks, magnetLink)
-	})
-
-	doc.Find(".area-links-download a").Each(func(_ int, s *goquery.Selection) {
-		// check for vacadb.org
-		href, exists := s.Attr("href")
-		if exists && strings.Contains(href, "vacadb.org") {
-			// extract the first query param value
-			u, err := url.Parse(href)
-			if err == nil {
-				queryID := u.Query().Get("id")
-				if queryID != "" {
-					magnetLink, err := soraFetcher.FetchLink(ctx, queryID)
-					if err == nil && magnetLink != "" {
-						magnetLinks = append(magnetLinks, magnetLink)
-					}
-				}
-			}
-		}
-	})
-
-	size = utils.StableUniq(size)
-
-	var chanIndexedTorrent = make(chan schema.IndexedTorrent)
-
-	// for each magnet link, create a new indexed torrent
-	for it, magnetLink := range magnetLinks {
-		it := it
-		go func(it int, magnetLink string) {
-			magnet, err := magnet.ParseMagnetUri(magnetLink)
-			if err != nil {
-				logging.Error().Err(err).Str("magnet_link", magnetLink).Msg("Failed to parse magnet URI")
-				chanIndexedTorrent <- schema.IndexedTorrent{}
-				return
-			}
-			releaseTitle := magnet.DisplayName
-			infoHash := magnet.InfoHash.String()
-			trackers := magnet.Trackers
-			magnetAudio := getAudioFromTitle(releaseTitle, audio)
-
-			peer, seed, err := goscrape.GetLeechsAndSeeds(ctx, i.redis, i.metrics, infoHash, trackers)
-			if err != nil {
-				logging.Error().Err(err).Str("info_hash", infoHash).Msg("Failed to get leechers and seeders")
-			}
-
-			processedTitle := processVacaTorrentTitle(title, magnetAudio, season)
+	// Extract magnet links, including the ones protected by vacadb.org
+	magnetLinks := findMagnetLinks(ctx, i, doc.Selection)
 
-			// if the number of sizes is equal to the number of magnets, then assign the size to each indexed torrent in order
-			var mySize string
-			if len(size) == len(magnetLinks) {
-				mySize = size[it]
-			}
-			if mySize == "" {
-				go func() {
-					_, _ = i.magnetMetadataAPI.FetchMetadata(ctx, magnetLink)
-				}()
-			}
+	category := findCategoryFromPost(doc.Find(".col-left, .content"), link)
 
-			ixt := schema.IndexedTorrent{
-				Title:         releaseTitle,
-				OriginalTitle: processedTitle,
-				Details:       link,
-				Year:          year,
-				IMDB:          imdbLink,
-				Audio:         magnetAudio,
-				MagnetLink:    magnetLink,
-				Date:          date,
-				InfoHash:      infoHash,
-				Trackers:      trackers,
-				LeechCount:    peer,
-				SeedCount:     seed,
-				Size:          mySize,
-			}
-			chanIndexedTorrent <- ixt
-		}(it, magnetLink)
-	}
-
-	for i := 0; i < len(magnetLinks); i++ {
-		it := <-chanIndexedTorrent
-		// Skip empty torrents (failed to parse)
-		if it.InfoHash != "" {
-			indexedTorrents = append(indexedTorrents, it)
-		}
+	post := postMetadata{
+		Link:     link,
+		Title:    title,
+		Year:     year,
+		IMDB:     imdbLink,
+		Audio:    audio,
+		Sizes:    size,
+		Date:     date,
+		Category: category,
+		OriginalTitle: func(audio []schema.Audio) string {
+			return processVacaTorrentTitle(title, audio, season)
+		},
 	}
 
-	return indexedTorrents, nil
+	return indexMagnetLinks(ctx, i, post, magnetLinks), nil
 }
 
 func processVacaTorrentTitle(title string, audio []schema.Audio, season string) string {
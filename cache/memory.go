@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryStore is an in-memory stand-in for the Redis server.
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value   []byte
+	expires time.Time // zero if the item never expires
+}
+
+// NewMemory returns a cache kept in memory instead of Redis, with the same
+// behaviour. It is meant for tests, where no Redis server is available.
+func NewMemory() *Redis {
+	return &Redis{
+		memory:            &memoryStore{items: make(map[string]memoryItem)},
+		defaultExpiration: DefaultExpiration,
+	}
+}
+
+func (m *memoryStore) get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok {
+		return nil, redis.Nil
+	}
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		delete(m.items, key)
+		return nil, redis.Nil
+	}
+	return slices.Clone(item.value), nil
+}
+
+func (m *memoryStore) set(key string, value []byte, expiration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(key, value, expiration)
+}
+
+func (m *memoryStore) setNX(key string, value []byte, expiration time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.items[key]; ok && (item.expires.IsZero() || time.Now().Before(item.expires)) {
+		return false
+	}
+	m.setLocked(key, value, expiration)
+	return true
+}
+
+// setLocked sets the item. The caller must hold the lock.
+func (m *memoryStore) setLocked(key string, value []byte, expiration time.Duration) {
+	item := memoryItem{value: slices.Clone(value)}
+	if expiration > 0 {
+		item.expires = time.Now().Add(expiration)
+	}
+	m.items[key] = item
+}
+
+func (m *memoryStore) del(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+}
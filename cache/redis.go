@@ -16,6 +16,7 @@ const (
 
 type Redis struct {
 	client            *redis.Client
+	memory            *memoryStore // used instead of the client if not nil
 	defaultExpiration time.Duration
 }
 
@@ -41,17 +42,40 @@ func (r *Redis) SetDefaultExpiration(expiration time.Duration) {
 }
 
 func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	if r.memory != nil {
+		return r.memory.get(key)
+	}
 	return r.client.Get(ctx, key).Bytes()
 }
 
 func (r *Redis) Set(ctx context.Context, key string, value []byte) error {
+	if r.memory != nil {
+		r.memory.set(key, value, r.defaultExpiration)
+		return nil
+	}
 	return r.client.Set(ctx, key, value, r.defaultExpiration).Err()
 }
 
 func (r *Redis) SetWithExpiration(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	if r.memory != nil {
+		r.memory.set(key, value, expiration)
+		return nil
+	}
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX sets the key only if it does not exist, reporting whether it was set.
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	if r.memory != nil {
+		return r.memory.setNX(key, value, expiration), nil
+	}
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 func (r *Redis) Del(ctx context.Context, key string) error {
+	if r.memory != nil {
+		r.memory.del(key)
+		return nil
+	}
 	return r.client.Del(ctx, key).Err()
 }
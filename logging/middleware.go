@@ -32,6 +32,12 @@ func (rw *ResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap returns the wrapped http.ResponseWriter, so http.ResponseController
+// can reach its Flush method when streaming responses.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // HTTPLoggingMiddleware logs HTTP requests in a structured format
 func HTTPLoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	handler "github.com/felipemarinho97/torrent-indexer/api"
@@ -11,6 +13,7 @@ import (
 	"github.com/felipemarinho97/torrent-indexer/logging"
 	"github.com/felipemarinho97/torrent-indexer/magnet"
 	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/proxy"
 	"github.com/felipemarinho97/torrent-indexer/public"
 	"github.com/felipemarinho97/torrent-indexer/requester"
 	meilisearch "github.com/felipemarinho97/torrent-indexer/search"
@@ -24,7 +27,14 @@ func main() {
 	logging.InitLogger()
 
 	redis := cache.NewRedis()
+	archiveMode := os.Getenv("REQUESTER_ARCHIVE_MODE")
 	searchIndex := meilisearch.NewSearchIndexer(os.Getenv("MEILISEARCH_ADDRESS"), os.Getenv("MEILISEARCH_KEY"), "torrents")
+	if os.Getenv("MEILISEARCH_ADDRESS") != "" {
+		// the /search category filter is applied by Meilisearch
+		if err := searchIndex.AddFilterableAttributes("category"); err != nil {
+			logging.Error().Err(err).Msg("Failed to set the Meilisearch filterable attributes")
+		}
+	}
 	var magnetMetadataAPI *magnet.MetadataClient
 	if os.Getenv("MAGNET_METADATA_API_ENABLED") == "true" {
 		timeout := 10 * time.Second
@@ -46,6 +56,22 @@ func main() {
 	}
 
 	flaresolverr := requester.NewFlareSolverr(os.Getenv("FLARESOLVERR_ADDRESS"), timeoutFlaresolverrMilli)
+	poolConfig := requester.DefaultSessionPoolConfig
+	if v, err := strconv.Atoi(os.Getenv("FLARESOLVERR_POOL_SIZE")); err == nil {
+		poolConfig.Size = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("FLARESOLVERR_SESSION_MAX_FAILURES")); err == nil {
+		poolConfig.MaxFailures = v
+	}
+	if d, err := str2duration.ParseDuration(os.Getenv("FLARESOLVERR_SESSION_MAX_AGE")); err == nil {
+		poolConfig.MaxAge = d
+	}
+	if d, err := str2duration.ParseDuration(os.Getenv("FLARESOLVERR_HEALTH_CHECK_INTERVAL")); err == nil {
+		poolConfig.HealthCheckInterval = d
+	}
+	flaresolverr.SetSessionPoolConfig(poolConfig)
+	flaresolverr.SetMetrics(metrics)
+	flaresolverr.Start(context.Background())
 
 	timeoutRequester := 5000 * time.Millisecond
 	if v := os.Getenv("REQUEST_TIMEOUT_MILLISECONDS"); v != "" {
@@ -53,7 +79,58 @@ func main() {
 			timeoutRequester = time.Duration(t) * time.Millisecond
 		}
 	}
+	maxProxyFailures := proxy.DefaultMaxFailures
+	if v, err := strconv.Atoi(os.Getenv("PROXY_MAX_FAILURES")); err == nil {
+		maxProxyFailures = v
+	}
+	if urls := os.Getenv("PROXY_URLS"); urls != "" {
+		pool, err := proxy.NewPool("default", strings.Split(urls, ","), maxProxyFailures)
+		if err != nil {
+			logging.Fatal().Err(err).Msg("Failed to parse PROXY_URLS")
+		}
+		proxy.SetDefault(pool)
+	}
+
 	req := requester.NewRequester(flaresolverr, redis, timeoutRequester)
+	hostLimit := requester.HostLimit{Rate: 5, Burst: 5, MaxConcurrency: 4}
+	if v, err := strconv.ParseFloat(os.Getenv("REQUESTER_RATE_LIMIT"), 64); err == nil {
+		hostLimit.Rate = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REQUESTER_BURST")); err == nil {
+		hostLimit.Burst = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REQUESTER_MAX_CONCURRENCY")); err == nil {
+		hostLimit.MaxConcurrency = v
+	}
+	req.SetDefaultHostLimit(hostLimit)
+	breakerConfig := requester.DefaultBreakerConfig
+	if v, err := strconv.Atoi(os.Getenv("BREAKER_FAILURES")); err == nil {
+		breakerConfig.Failures = v
+	}
+	if d, err := str2duration.ParseDuration(os.Getenv("BREAKER_OPEN_TIMEOUT")); err == nil {
+		breakerConfig.OpenTimeout = d
+	}
+	req.SetBreakerConfig(breakerConfig)
+	retryConfig := requester.DefaultRetryConfig
+	if v, err := strconv.Atoi(os.Getenv("REQUEST_RETRIES")); err == nil {
+		retryConfig.Retries = v
+	}
+	if d, err := str2duration.ParseDuration(os.Getenv("REQUEST_RETRY_BASE_DELAY")); err == nil {
+		retryConfig.BaseDelay = d
+	}
+	if d, err := str2duration.ParseDuration(os.Getenv("REQUEST_RETRY_MAX_DELAY")); err == nil {
+		retryConfig.MaxDelay = d
+	}
+	req.SetRetryConfig(retryConfig)
+	if archiveMode != "" {
+		dir := os.Getenv("REQUESTER_ARCHIVE_DIR")
+		archive, err := requester.NewArchive(dir, archiveMode)
+		if err != nil {
+			logging.Fatal().Err(err).Str("dir", dir).Msg("Failed to open requester archive")
+		}
+		logging.Info().Str("dir", dir).Str("mode", archiveMode).Msg("Using requester archive")
+		req.SetArchive(archive)
+	}
 
 	// get shot-lived and long-lived cache expiration from env
 	shortLivedCacheExpiration, err := str2duration.ParseDuration(os.Getenv("SHORT_LIVED_CACHE_EXPIRATION"))
@@ -73,23 +150,122 @@ func main() {
 		FallbackTitleEnabled: os.Getenv("FALLBACK_TITLE_ENABLED") == "true",
 	}
 
+	if dir := os.Getenv("INDEXER_DEFINITIONS_DIR"); dir != "" {
+		definitions, err := handler.LoadSiteDefinitions(dir)
+		if err != nil {
+			logging.Error().Err(err).Str("dir", dir).Msg("Failed to load site definitions")
+		}
+		for _, site := range definitions {
+			if err := handler.RegisterSite(site); err != nil {
+				logging.Error().Err(err).Msg("Failed to register site definition")
+			}
+		}
+	}
+
+	for _, site := range handler.Sites() {
+		meta := site.Meta()
+		urls := append([]string{meta.URL}, meta.Mirrors...)
+		req.AddMirrors(urls...)
+
+		limit, custom := hostLimit, false
+		if v, err := strconv.ParseFloat(os.Getenv(indexerEnv(meta.Name, "RATE_LIMIT")), 64); err == nil {
+			limit.Rate, custom = v, true
+		}
+		if v, err := strconv.Atoi(os.Getenv(indexerEnv(meta.Name, "BURST"))); err == nil {
+			limit.Burst, custom = v, true
+		}
+		if v, err := strconv.Atoi(os.Getenv(indexerEnv(meta.Name, "MAX_CONCURRENCY"))); err == nil {
+			limit.MaxConcurrency, custom = v, true
+		}
+		if custom {
+			req.SetHostLimit(limit, urls...)
+		}
+
+		switch proxyURLs := os.Getenv(indexerEnv(meta.Name, "PROXY_URLS")); proxyURLs {
+		case "":
+		case "direct":
+			proxy.Assign(nil, urls...)
+		default:
+			pool, err := proxy.NewPool(meta.Name, strings.Split(proxyURLs, ","), maxProxyFailures)
+			if err != nil {
+				logging.Fatal().Err(err).Str("indexer", meta.Name).Msg("Failed to parse the proxy urls of the indexer")
+			}
+			proxy.Assign(pool, urls...)
+		}
+	}
+
+	proxyCheckInterval := 5 * time.Minute
+	if d, err := str2duration.ParseDuration(os.Getenv("PROXY_HEALTH_CHECK_INTERVAL")); err == nil {
+		proxyCheckInterval = d
+	}
+	proxyCheckURL := os.Getenv("PROXY_HEALTH_CHECK_URL")
+	if proxyCheckURL == "" {
+		proxyCheckURL = "https://www.gstatic.com/generate_204"
+	}
+	for _, pool := range proxy.Pools() {
+		logging.Info().Str("pool", pool.Name()).Int("proxies", pool.Healthy()).Msg("Using proxy pool")
+		if proxyCheckInterval > 0 {
+			pool.StartHealthCheck(context.Background(), proxyCheckInterval, proxyCheckURL)
+		}
+	}
+
 	indexers := handler.NewIndexers(icfg, redis, metrics, req, searchIndex, magnetMetadataAPI)
 	search := handler.NewMeilisearchHandler(searchIndex)
 
+	var crawler *handler.Crawler
+	if os.Getenv("CRAWLER_ENABLED") == "true" {
+		ccfg := handler.CrawlerConfig{Intervals: make(map[string]time.Duration)}
+		if v, err := strconv.Atoi(os.Getenv("CRAWLER_PAGES")); err == nil {
+			ccfg.Pages = v
+		}
+		if d, err := str2duration.ParseDuration(os.Getenv("CRAWLER_INTERVAL")); err == nil {
+			ccfg.Interval = d
+		}
+		if d, err := str2duration.ParseDuration(os.Getenv("CRAWLER_JITTER")); err == nil {
+			ccfg.Jitter = d
+		}
+		for _, name := range handler.SiteNames() {
+			if d, err := str2duration.ParseDuration(os.Getenv(indexerEnv(name, "CRAWL_INTERVAL"))); err == nil {
+				ccfg.Intervals[name] = d
+			}
+		}
+		crawler = handler.NewCrawler(indexers, ccfg)
+		logging.Info().Msg("Starting background crawler")
+		crawler.Start(context.Background())
+	}
+
+	bcfg := handler.BackfillConfig{}
+	if d, err := str2duration.ParseDuration(os.Getenv("BACKFILL_DELAY")); err == nil {
+		bcfg.Delay = d
+	}
+	if v, err := strconv.Atoi(os.Getenv("BACKFILL_MAX_PAGES")); err == nil {
+		bcfg.MaxPages = v
+	}
+	backfiller := handler.NewBackfiller(indexers, bcfg)
+	backfiller.Resume()
+	adminKey := os.Getenv("ADMIN_API_KEY")
+
 	indexerMux := http.NewServeMux()
 	metricsMux := http.NewServeMux()
 
 	indexerMux.HandleFunc("/", handler.HandlerIndex)
-	indexerMux.HandleFunc("/indexers/bludv", indexers.HandlerBluDVIndexer)
-	indexerMux.HandleFunc("/indexers/comando_torrents", indexers.HandlerComandoIndexer)
-	indexerMux.HandleFunc("/indexers/rede_torrent", indexers.HandlerRedeTorrentIndexer)
-	indexerMux.HandleFunc("/indexers/starck-filmes", indexers.HandlerStarckFilmesIndexer)
-	indexerMux.HandleFunc("/indexers/torrent-dos-filmes", indexers.HandlerTorrentDosFilmesIndexer)
-	indexerMux.HandleFunc("/indexers/vaca_torrent", indexers.HandlerVacaTorrentIndexer)
+	indexerMux.HandleFunc("/indexers/all", indexers.HandlerAllIndexers)
+	for _, site := range handler.Sites() {
+		indexerMux.HandleFunc("/indexers/"+site.Meta().Name, indexers.HandlerSite(site))
+	}
 	indexerMux.HandleFunc("/indexers/manual", indexers.HandlerManualIndexer)
+	indexerMux.HandleFunc("/indexers/status", indexers.HandlerIndexerStatus)
+	indexerMux.HandleFunc("/indexers/{indexer}/rss", indexers.HandlerRSS)
+	indexerMux.HandleFunc("/rss", indexers.HandlerRSS)
+	indexerMux.HandleFunc("/torznab/{indexer}/api", indexers.HandlerTorznab)
 	indexerMux.HandleFunc("/search", search.SearchTorrentHandler)
 	indexerMux.HandleFunc("/search/health", search.HealthHandler)
 	indexerMux.HandleFunc("/search/stats", search.StatsHandler)
+	indexerMux.HandleFunc("/crawler/status", crawler.HandlerCrawlerStatus)
+	indexerMux.HandleFunc("/admin/backfill", handler.AdminAuth(adminKey, backfiller.HandlerBackfill))
+	indexerMux.HandleFunc("/admin/backfill/{indexer}", handler.AdminAuth(adminKey, backfiller.HandlerBackfill))
+	indexerMux.HandleFunc("/saved-searches", handler.AdminAuth(adminKey, indexers.HandlerSavedSearches))
+	indexerMux.HandleFunc("/saved-searches/{id}", handler.AdminAuth(adminKey, indexers.HandlerSavedSearches))
 	indexerMux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.FS(public.UIFiles))))
 
 	loggedIndexerMux := logging.HTTPLoggingMiddleware(indexerMux)
@@ -119,3 +295,9 @@ func main() {
 		logging.Fatal().Err(err).Msg("Server failed to start")
 	}
 }
+
+// indexerEnv returns the name of the environment variable with the setting
+// of the indexer, e.g. INDEXER_BLUDV_CRAWL_INTERVAL.
+func indexerEnv(name, setting string) string {
+	return "INDEXER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_" + setting
+}
@@ -10,6 +10,22 @@ type Metrics struct {
 	IndexerRequests *prometheus.CounterVec
 	CacheHits       *prometheus.CounterVec
 	CacheMisses     *prometheus.CounterVec
+
+	IndexerLastSuccess         *prometheus.GaugeVec
+	IndexerConsecutiveFailures *prometheus.GaugeVec
+	IndexerPostsPerPage        *prometheus.GaugeVec
+	IndexerTorrentsPerPost     *prometheus.GaugeVec
+	IndexerLayoutBroken        *prometheus.GaugeVec
+	IndexerDomainMoves         *prometheus.CounterVec
+	LinkResolverRequests       *prometheus.CounterVec
+	RequesterQueueWait         *prometheus.HistogramVec
+	CircuitBreakerState        *prometheus.GaugeVec
+
+	FlareSolverrPoolSize         prometheus.Gauge
+	FlareSolverrSessionsInUse    prometheus.Gauge
+	FlareSolverrSessionWait      prometheus.Histogram
+	FlareSolverrSolveDuration    *prometheus.HistogramVec
+	FlareSolverrSessionsRecycled *prometheus.CounterVec
 }
 
 func NewMetrics() *Metrics {
@@ -35,6 +51,65 @@ func NewMetrics() *Metrics {
 			Name: "cache_misses_total",
 			Help: "Number of cache misses",
 		}, []string{"cache"}),
+		IndexerLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexer_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful scrape of the indexer",
+		}, []string{"indexer"}),
+		IndexerConsecutiveFailures: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexer_consecutive_failures",
+			Help: "Number of consecutive failed scrapes of the indexer",
+		}, []string{"indexer"}),
+		IndexerPostsPerPage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexer_posts_per_page",
+			Help: "Moving average of posts found per list page",
+		}, []string{"indexer"}),
+		IndexerTorrentsPerPost: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexer_torrents_per_post",
+			Help: "Moving average of torrents found per post",
+		}, []string{"indexer"}),
+		IndexerLayoutBroken: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexer_layout_possibly_broken",
+			Help: "1 if the selectors of the indexer suddenly stopped matching, 0 otherwise",
+		}, []string{"indexer"}),
+		IndexerDomainMoves: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "indexer_domain_moves_total",
+			Help: "Number of times the indexer was found to have moved to a new domain",
+		}, []string{"indexer"}),
+		LinkResolverRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "link_resolver_requests_total",
+			Help: "Number of protected links decoded by each link resolver, by result",
+		}, []string{"resolver", "result"}),
+		RequesterQueueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "requester_queue_wait_seconds",
+			Help:    "Time requests waited for the rate limit and concurrency cap of their host",
+			Buckets: []float64{0, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30},
+		}, []string{"host"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of the circuit breaker of each upstream host and of FlareSolverr: 0 closed, 1 half-open, 2 open",
+		}, []string{"upstream"}),
+		FlareSolverrPoolSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "flaresolverr_session_pool_size",
+			Help: "Number of sessions open in the FlareSolverr session pool, idle or in use",
+		}),
+		FlareSolverrSessionsInUse: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "flaresolverr_sessions_in_use",
+			Help: "Number of FlareSolverr sessions solving a request",
+		}),
+		FlareSolverrSessionWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "flaresolverr_session_wait_seconds",
+			Help:    "Time requests waited for a free FlareSolverr session",
+			Buckets: []float64{0, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+		}),
+		FlareSolverrSolveDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "flaresolverr_solve_duration_seconds",
+			Help:    "Duration of the requests solved by FlareSolverr, by result",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60},
+		}, []string{"result"}),
+		FlareSolverrSessionsRecycled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flaresolverr_sessions_recycled_total",
+			Help: "Number of FlareSolverr sessions destroyed and recreated, by reason",
+		}, []string{"reason"}),
 	}
 }
 
@@ -44,4 +119,18 @@ func (m *Metrics) Register() {
 	prometheus.MustRegister(m.IndexerRequests)
 	prometheus.MustRegister(m.CacheHits)
 	prometheus.MustRegister(m.CacheMisses)
+	prometheus.MustRegister(m.IndexerLastSuccess)
+	prometheus.MustRegister(m.IndexerConsecutiveFailures)
+	prometheus.MustRegister(m.IndexerPostsPerPage)
+	prometheus.MustRegister(m.IndexerTorrentsPerPost)
+	prometheus.MustRegister(m.IndexerLayoutBroken)
+	prometheus.MustRegister(m.IndexerDomainMoves)
+	prometheus.MustRegister(m.LinkResolverRequests)
+	prometheus.MustRegister(m.RequesterQueueWait)
+	prometheus.MustRegister(m.CircuitBreakerState)
+	prometheus.MustRegister(m.FlareSolverrPoolSize)
+	prometheus.MustRegister(m.FlareSolverrSessionsInUse)
+	prometheus.MustRegister(m.FlareSolverrSessionWait)
+	prometheus.MustRegister(m.FlareSolverrSolveDuration)
+	prometheus.MustRegister(m.FlareSolverrSessionsRecycled)
 }
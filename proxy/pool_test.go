@@ -0,0 +1,140 @@
+package proxy_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/proxy"
+)
+
+func Test_PoolRoundRobin(t *testing.T) {
+	pool, err := proxy.NewPool("test", []string{"http://a:8080", " socks5://user:pass@b:1080 ", ""}, 2)
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	first, _ := pool.Next()
+	second, _ := pool.Next()
+	third, _ := pool.Next()
+	if first.Host != "a:8080" || second.Host != "b:1080" || third != first {
+		t.Errorf("Next() = %v, %v, %v, want a, b, a", first, second, third)
+	}
+
+	// b is removed after two failures in a row, a success in between resets them
+	pool.ReportFailure(second, errors.New("refused"))
+	pool.ReportSuccess(second)
+	pool.ReportFailure(second, errors.New("refused"))
+	if got := pool.Healthy(); got != 2 {
+		t.Fatalf("Healthy() = %d, want 2", got)
+	}
+	pool.ReportFailure(second, errors.New("refused"))
+	if got := pool.Healthy(); got != 1 {
+		t.Fatalf("Healthy() = %d, want 1", got)
+	}
+	for range 3 {
+		if u, _ := pool.Next(); u != first {
+			t.Errorf("Next() = %v, want only a", u)
+		}
+	}
+
+	pool.ReportFailure(first, errors.New("refused"))
+	pool.ReportFailure(first, errors.New("refused"))
+	if _, err := pool.Next(); !errors.Is(err, proxy.ErrNoHealthyProxy) {
+		t.Errorf("Next() without healthy proxies error = %v, want %v", err, proxy.ErrNoHealthyProxy)
+	}
+
+	// the health checks add the proxies back
+	pool.ReportSuccess(second)
+	if u, err := pool.Next(); err != nil || u != second {
+		t.Errorf("Next() = %v, %v, want b", u, err)
+	}
+}
+
+func Test_NewPool(t *testing.T) {
+	if _, err := proxy.NewPool("test", []string{"ftp://a:21"}, 0); err == nil {
+		t.Errorf("NewPool() with an ftp proxy, want error")
+	}
+	if _, err := proxy.NewPool("test", []string{""}, 0); err == nil {
+		t.Errorf("NewPool() without proxies, want error")
+	}
+}
+
+func Test_Transport(t *testing.T) {
+	var proxied atomic.Int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		if r.URL.Host != "site.example" {
+			t.Errorf("proxied request host = %q, want site.example", r.URL.Host)
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer proxyServer.Close()
+
+	pool, err := proxy.NewPool("test", []string{proxyServer.URL}, 0)
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	proxy.Assign(pool, "http://site.example/")
+	defer proxy.Assign(nil, "http://site.example/")
+
+	client := &http.Client{Transport: proxy.NewTransport(&http.Transport{})}
+	resp, err := client.Get("http://site.example/page")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if got := proxied.Load(); got != 1 {
+		t.Errorf("proxied requests = %d, want 1", got)
+	}
+	if proxy.For("http://other.example/") != nil {
+		t.Errorf("For() of a host without a pool, want nil")
+	}
+}
+
+func Test_TransportFallbackAndFailures(t *testing.T) {
+	var proxied atomic.Int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxyServer.Close()
+	proxyURL, _ := url.Parse(proxyServer.URL)
+
+	// hosts without a pool keep the proxy of the base transport
+	client := &http.Client{Transport: proxy.NewTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)})}
+	resp, err := client.Get("http://unassigned.example/")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if got := proxied.Load(); got != 1 {
+		t.Errorf("requests through the base proxy = %d, want 1", got)
+	}
+
+	// only the errors of the proxy count against it
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	pool, err := proxy.NewPool("test", []string{dead.URL}, 1)
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	proxy.Assign(pool, "http://site.example/")
+	defer proxy.Assign(nil, "http://site.example/")
+
+	_, err = client.Get("http://site.example/")
+	if !proxy.IsProxyError(err) {
+		t.Errorf("IsProxyError(%v) = false, want true", err)
+	}
+	if got := pool.Healthy(); got != 0 {
+		t.Errorf("Healthy() = %d, want 0", got)
+	}
+	if proxy.IsProxyError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}) {
+		t.Errorf("IsProxyError() of a site error = true, want false")
+	}
+}
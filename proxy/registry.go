@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	mu          sync.RWMutex
+	defaultPool *Pool
+	hostPools   = make(map[string]*Pool)
+)
+
+// SetDefault sets the pool of the hosts without a pool of their own, e.g. the
+// tracker lists and the link protectors. A nil pool connects directly.
+func SetDefault(pool *Pool) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultPool = pool
+}
+
+// Assign sets the pool of the hosts of the URLs, usually the base URL and
+// mirrors of an indexer.
+func Assign(pool *Pool, urls ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, raw := range urls {
+		if host := hostOf(raw); host != "" {
+			hostPools[host] = pool
+		}
+	}
+}
+
+// For returns the pool of the host of the URL, or nil to connect directly.
+func For(rawURL string) *Pool {
+	return forHost(hostOf(rawURL))
+}
+
+// Pools returns the default pool and every assigned pool, without duplicates.
+func Pools() []*Pool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var pools []*Pool
+	seen := make(map[*Pool]bool)
+	add := func(pool *Pool) {
+		if pool != nil && !seen[pool] {
+			seen[pool] = true
+			pools = append(pools, pool)
+		}
+	}
+	add(defaultPool)
+	for _, pool := range hostPools {
+		add(pool)
+	}
+	return pools
+}
+
+func forHost(host string) *Pool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if pool, ok := hostPools[host]; ok {
+		return pool
+	}
+	return defaultPool
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
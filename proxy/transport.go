@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type proxyKey struct{}
+
+// ConnectError is returned when a proxy answers the CONNECT of a request
+// with another status than 200.
+type ConnectError struct {
+	Proxy  string
+	Status string
+}
+
+func (e *ConnectError) Error() string {
+	return "proxy " + e.Proxy + " refused to connect: " + e.Status
+}
+
+// Transport sends each request through the next proxy of the pool of its
+// host, reporting the failures of the proxies to the pool. Requests to hosts
+// without a pool use the proxy of the base transport, usually the one of the
+// HTTP_PROXY and HTTPS_PROXY environment variables.
+type Transport struct {
+	base     *http.Transport
+	fallback func(*http.Request) (*url.URL, error)
+}
+
+// NewTransport wraps the base transport, replacing its Proxy function. A nil
+// Proxy is replaced by http.ProxyFromEnvironment for the hosts without a pool.
+func NewTransport(base *http.Transport) *Transport {
+	t := &Transport{base: base, fallback: base.Proxy}
+	if t.fallback == nil {
+		t.fallback = http.ProxyFromEnvironment
+	}
+	base.Proxy = t.proxy
+
+	onConnect := base.OnProxyConnectResponse
+	base.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, req *http.Request, resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return &ConnectError{Proxy: proxyURL.Redacted(), Status: resp.Status}
+		}
+		if onConnect != nil {
+			return onConnect(ctx, proxyURL, req, resp)
+		}
+		return nil
+	}
+	return t
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pool := forHost(strings.ToLower(req.URL.Host))
+	if pool == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	u, err := pool.Next()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, u)))
+	switch {
+	case err == nil:
+		pool.ReportSuccess(u)
+	case IsProxyError(err):
+		pool.ReportFailure(u, err)
+	}
+	// errors of the site are left to the circuit breakers and retries
+	return resp, err
+}
+
+// IsProxyError reports whether the error was caused by the proxy rather than
+// the site: the proxy could not be reached, refused the CONNECT or the SOCKS
+// handshake failed.
+func IsProxyError(err error) bool {
+	var connectErr *ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	return opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks ")
+}
+
+// proxy is the Proxy function of the base transport, returning the proxy
+// chosen by RoundTrip, or the one of the base transport if there is none.
+func (t *Transport) proxy(req *http.Request) (*url.URL, error) {
+	if u, ok := req.Context().Value(proxyKey{}).(*url.URL); ok {
+		return u, nil
+	}
+	return t.fallback(req)
+}
@@ -0,0 +1,201 @@
+// Package release parses scene-style release names, like
+// "Movie.2024.1080p.WEB-DL.DDP5.1.H.264-GROUP", into structured fields.
+package release
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Info is the structured information found in a release name.
+// Empty fields were not found.
+type Info struct {
+	Resolution    string // 480p, 720p, 1080p or 2160p
+	Source        string // WEB-DL, WEBRip, BluRay, BDRip, HDTV, DVDRip, TS or CAM
+	VideoCodec    string // x264, x265, AV1, XviD or VP9
+	HDR           bool
+	DolbyVision   bool
+	AudioCodec    string // AAC, AC3, DDP, DTS, DTS-HD, TrueHD, Atmos, FLAC, MP3 or OPUS
+	AudioChannels string // 2.0, 5.1 or 7.1
+	Group         string
+}
+
+type pattern struct {
+	value string
+	re    *regexp.Regexp
+}
+
+// The patterns are tried in order, so the more specific ones come first.
+var (
+	resolutionPatterns = []pattern{
+		{"2160p", regexp.MustCompile(`(?i)\b(2160p|4k|uhd)\b`)},
+		{"1080p", regexp.MustCompile(`(?i)\b(1080[pi]|fhd|full ?hd)\b`)},
+		{"720p", regexp.MustCompile(`(?i)\b720p\b`)},
+		{"480p", regexp.MustCompile(`(?i)\b(480p|576p)\b`)},
+	}
+	sourcePatterns = []pattern{
+		{"CAM", regexp.MustCompile(`(?i)\b(cam|camrip|hdcam)\b`)},
+		{"TS", regexp.MustCompile(`(?i)\b(telesync|hdts|telecine)\b`)},
+		{"WEBRip", regexp.MustCompile(`(?i)\bweb[ .-]?rip\b`)},
+		{"WEB-DL", regexp.MustCompile(`(?i)\b(web[ .-]?dl|webdl|amzn|dsnp|hmax|atvp)\b`)},
+		{"BDRip", regexp.MustCompile(`(?i)\b(bd[ .-]?rip|br[ .-]?rip)\b`)},
+		{"BluRay", regexp.MustCompile(`(?i)\b(blu[ .-]?ray|bd|remux)\b`)},
+		{"HDTV", regexp.MustCompile(`(?i)\b(hdtv|pdtv|tvrip)\b`)},
+		{"DVDRip", regexp.MustCompile(`(?i)\b(dvd[ .-]?rip|dvd)\b`)},
+	}
+	// the source tags that are also common words or initials in titles, like
+	// "Charlotte's Web" or "TC", only count in upper case between the
+	// separators of release names, e.g. ".WEB." or "-TS-"
+	sourceTagPatterns = []pattern{
+		{"TS", regexp.MustCompile(`(?:^|[._\-\[(])(TS|TC)(?:$|[._\-\])])`)},
+		{"WEB-DL", regexp.MustCompile(`(?:^|[._\-\[(])(WEB|NF)(?:$|[._\-\])])`)},
+	}
+	videoCodecPatterns = []pattern{
+		{"x265", regexp.MustCompile(`(?i)\b(x265|h\.?265|hevc)\b`)},
+		{"x264", regexp.MustCompile(`(?i)\b(x264|h\.?264|avc)\b`)},
+		{"AV1", regexp.MustCompile(`(?i)\bav1\b`)},
+		{"VP9", regexp.MustCompile(`(?i)\bvp9\b`)},
+		{"XviD", regexp.MustCompile(`(?i)\b(xvid|divx)\b`)},
+	}
+	audioCodecPatterns = []pattern{
+		{"Atmos", regexp.MustCompile(`(?i)\batmos\b`)},
+		{"TrueHD", regexp.MustCompile(`(?i)\btrue[ .-]?hd\b`)},
+		{"DTS-HD", regexp.MustCompile(`(?i)\bdts[ .-]?(hd|ma|x)\b`)},
+		{"DTS", regexp.MustCompile(`(?i)\bdts\b`)},
+		{"DDP", regexp.MustCompile(`(?i)\b(ddp|dd\+|e-?ac-?3)`)},
+		{"AC3", regexp.MustCompile(`(?i)\b(ac-?3|dd\d?)\b`)},
+		{"AAC", regexp.MustCompile(`(?i)\baac`)},
+		{"FLAC", regexp.MustCompile(`(?i)\bflac\b`)},
+		{"OPUS", regexp.MustCompile(`(?i)\bopus\b`)},
+		{"MP3", regexp.MustCompile(`(?i)\bmp3\b`)},
+	}
+
+	hdrRE         = regexp.MustCompile(`(?i)\b(hdr|hdr10\+?|hlg)\b`)
+	dolbyVisionRE = regexp.MustCompile(`(?i)\b(dv|dovi|dolby[ .-]?vision)\b`)
+	channelsRE    = regexp.MustCompile(`(?:^|[^\d])([1-7])[ .]([01])(?:ch)?\b`)
+	// "-GROUP" at the end of the name, after removing extensions and tags like "(brazilian, eng)"
+	groupRE    = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	trailingRE = regexp.MustCompile(`\s*(\([^)]*\)|\[[^\]]*\])\s*$`)
+)
+
+// notGroups are words found after a dash at the end of names that are not
+// release groups, like the end of "WEB-DL".
+var notGroups = map[string]bool{
+	"audio": true, "dual": true, "dl": true, "rip": true, "dublado": true, "legendado": true, "nacional": true, "completa": true,
+}
+
+var fileExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".avi": true, ".m4v": true, ".wmv": true, ".mov": true, ".torrent": true,
+}
+
+// resolutionRanks orders the resolutions, from lower to higher.
+var resolutionRanks = map[string]int{
+	"480p":  1,
+	"720p":  2,
+	"1080p": 3,
+	"2160p": 4,
+}
+
+// Parse extracts the release information from a release name.
+func Parse(name string) Info {
+	name = strings.TrimSpace(name)
+	if fileExtensions[strings.ToLower(path.Ext(name))] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	// dots and underscores are word separators in release names
+	normalized := strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	// keep the dots of the codecs and channels, e.g. H.264 and 5.1
+	withDots := strings.ReplaceAll(name, "_", " ")
+
+	info := Info{
+		Resolution:  match(resolutionPatterns, normalized),
+		Source:      matchSource(normalized, name),
+		VideoCodec:  match(videoCodecPatterns, withDots),
+		HDR:         hdrRE.MatchString(normalized),
+		DolbyVision: dolbyVisionRE.MatchString(normalized),
+		AudioCodec:  match(audioCodecPatterns, normalized),
+		Group:       parseGroup(name),
+	}
+	if info.VideoCodec == "" {
+		info.VideoCodec = match(videoCodecPatterns, normalized)
+	}
+	if m := channelsRE.FindStringSubmatch(withDots); m != nil {
+		info.AudioChannels = m[1] + "." + m[2]
+	}
+
+	return info
+}
+
+// ParseFile extracts the release information from the name of a file in a torrent,
+// ignoring the directories of its path.
+func ParseFile(filePath string) Info {
+	return Parse(path.Base(strings.ReplaceAll(filePath, "\\", "/")))
+}
+
+// Merge fills the empty fields of i with the ones from other.
+func (i Info) Merge(other Info) Info {
+	if i.Resolution == "" {
+		i.Resolution = other.Resolution
+	}
+	if i.Source == "" {
+		i.Source = other.Source
+	}
+	if i.VideoCodec == "" {
+		i.VideoCodec = other.VideoCodec
+	}
+	if i.AudioCodec == "" {
+		i.AudioCodec = other.AudioCodec
+	}
+	if i.AudioChannels == "" {
+		i.AudioChannels = other.AudioChannels
+	}
+	if i.Group == "" {
+		i.Group = other.Group
+	}
+	i.HDR = i.HDR || other.HDR
+	i.DolbyVision = i.DolbyVision || other.DolbyVision
+	return i
+}
+
+// ResolutionRank returns a number to compare resolutions, 0 if unknown.
+func ResolutionRank(resolution string) int {
+	return resolutionRanks[strings.ToLower(resolution)]
+}
+
+func match(patterns []pattern, s string) string {
+	for _, p := range patterns {
+		if p.re.MatchString(s) {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// matchSource finds the source in the normalized name, or in the tags
+// between the separators of the raw one.
+func matchSource(normalized, raw string) string {
+	if source := match(sourcePatterns, normalized); source != "" {
+		return source
+	}
+	return match(sourceTagPatterns, raw)
+}
+
+func parseGroup(name string) string {
+	for {
+		trimmed := trailingRE.ReplaceAllString(name, "")
+		if trimmed == name {
+			break
+		}
+		name = trimmed
+	}
+	m := groupRE.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	// not a group, e.g. "WEB-DL" or "x264-1080p"
+	if notGroups[strings.ToLower(m[1])] || matchSource(m[1], m[1]) != "" || match(resolutionPatterns, m[1]) != "" {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,132 @@
+package release_test
+
+import (
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/release"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  release.Info
+	}{
+		{
+			name:  "should parse scene web release",
+			input: "The.Boys.S04E01.1080p.AMZN.WEB-DL.DDP5.1.H.264-FLUX",
+			want: release.Info{
+				Resolution:    "1080p",
+				Source:        "WEB-DL",
+				VideoCodec:    "x264",
+				AudioCodec:    "DDP",
+				AudioChannels: "5.1",
+				Group:         "FLUX",
+			},
+		},
+		{
+			name:  "should parse 4k hdr bluray remux",
+			input: "Dune.Part.Two.2024.2160p.UHD.BluRay.REMUX.DV.HDR.HEVC.TrueHD.7.1-FGT.mkv",
+			want: release.Info{
+				Resolution:    "2160p",
+				Source:        "BluRay",
+				VideoCodec:    "x265",
+				HDR:           true,
+				DolbyVision:   true,
+				AudioCodec:    "TrueHD",
+				AudioChannels: "7.1",
+				Group:         "FGT",
+			},
+		},
+		{
+			name:  "should ignore audio tags appended to the title",
+			input: "Movie 2024 HDCAM x264-GRP (brazilian, eng)",
+			want: release.Info{
+				Source:     "CAM",
+				VideoCodec: "x264",
+				Group:      "GRP",
+			},
+		},
+		{
+			name:  "should parse brazilian post title without group",
+			input: "Duna Parte Dois (2024) WEB-DL 1080p Dual Áudio",
+			want: release.Info{
+				Resolution: "1080p",
+				Source:     "WEB-DL",
+			},
+		},
+		{
+			name:  "should parse streaming service tags",
+			input: "Movie.2024.1080p.NF.WEB.H264-GRP",
+			want: release.Info{
+				Resolution: "1080p",
+				Source:     "WEB-DL",
+				VideoCodec: "x264",
+				Group:      "GRP",
+			},
+		},
+		{
+			name:  "should parse telesync tag",
+			input: "Movie.2024.TS.x264-GRP",
+			want: release.Info{
+				Source:     "TS",
+				VideoCodec: "x264",
+				Group:      "GRP",
+			},
+		},
+		{
+			name:  "should not take words of the title for sources",
+			input: "Charlotte's Web 2006 1080p BluRay",
+			want: release.Info{
+				Resolution: "1080p",
+				Source:     "BluRay",
+			},
+		},
+		{
+			name:  "should not take initials of the title for sources",
+			input: "The TC Show S01E01 720p HDTV",
+			want: release.Info{
+				Resolution: "720p",
+				Source:     "HDTV",
+			},
+		},
+		{
+			name:  "should keep titles with slashes",
+			input: "Duna 1080p/720p WEB-DL",
+			want: release.Info{
+				Resolution: "1080p",
+				Source:     "WEB-DL",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := release.Parse(tt.input); got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	got := release.ParseFile("Movie (2023)/Movie.2023.720p.WEBRip.x265.AAC2.0-GalaxyRG.mp4")
+	want := release.Info{
+		Resolution:    "720p",
+		Source:        "WEBRip",
+		VideoCodec:    "x265",
+		AudioCodec:    "AAC",
+		AudioChannels: "2.0",
+		Group:         "GalaxyRG",
+	}
+	if got != want {
+		t.Errorf("ParseFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInfo_Merge(t *testing.T) {
+	got := release.Info{Resolution: "1080p"}.Merge(release.Info{Resolution: "720p", VideoCodec: "x265", HDR: true})
+	want := release.Info{Resolution: "1080p", VideoCodec: "x265", HDR: true}
+	if got != want {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+}
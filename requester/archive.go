@@ -0,0 +1,110 @@
+package requester
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Modes of an Archive.
+const (
+	ArchiveRecord = "record" // save every fetched body to the archive
+	ArchiveReplay = "replay" // serve every request from the archive, without network
+)
+
+// ErrNotArchived is returned in replay mode for requests missing from the archive.
+var ErrNotArchived = errors.New("request not found in archive")
+
+// Archive saves the bodies fetched by the requester to a directory, one JSON
+// file per request, so they can be replayed later without network. This
+// makes the parser bugs reproducible from the archive of the pages that
+// triggered them.
+type Archive struct {
+	dir  string
+	mode string
+}
+
+// archiveEntry is the file of a request in the archive.
+type archiveEntry struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body"`
+}
+
+// NewArchive returns an archive in the directory, creating it in record mode.
+func NewArchive(dir, mode string) (*Archive, error) {
+	switch mode {
+	case ArchiveRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	case ArchiveReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("failed to open archive directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown archive mode: %q", mode)
+	}
+	return &Archive{dir: dir, mode: mode}, nil
+}
+
+// Replaying reports whether the requests must be served from the archive.
+func (a *Archive) Replaying() bool {
+	return a != nil && a.mode == ArchiveReplay
+}
+
+// Recording reports whether the fetched bodies must be saved to the archive.
+func (a *Archive) Recording() bool {
+	return a != nil && a.mode == ArchiveRecord
+}
+
+// Save stores the response body of the request.
+func (a *Archive) Save(method, rawURL string, reqBody, body []byte) error {
+	path := a.path(method, rawURL, reqBody)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	content, err := json.MarshalIndent(archiveEntry{Method: method, URL: rawURL, Body: string(body)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// Load returns the response body of the request.
+func (a *Archive) Load(method, rawURL string, reqBody []byte) ([]byte, error) {
+	content, err := os.ReadFile(a.path(method, rawURL, reqBody))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotArchived, method, rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry archiveEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse archive entry of %s: %w", rawURL, err)
+	}
+	return []byte(entry.Body), nil
+}
+
+// path returns the file of the request: a directory per host and a file
+// named by the hash of the method, URL and request body.
+func (a *Archive) path(method, rawURL string, reqBody []byte) string {
+	host := "unknown"
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = strings.ReplaceAll(u.Host, ":", "_")
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + rawURL + "\n"))
+	hash.Write(reqBody)
+	return filepath.Join(a.dir, host, hex.EncodeToString(hash.Sum(nil))[:32]+".json")
+}
@@ -0,0 +1,115 @@
+package requester_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+func Test_ArchiveReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	record, err := requester.NewArchive(dir, requester.ArchiveRecord)
+	if err != nil {
+		t.Fatalf("NewArchive() error = %v", err)
+	}
+	if err := record.Save("GET", "https://example.com/post/", nil, []byte("<html>post</html>")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := record.Save("POST", "https://example.com/search", []byte("q=a"), []byte(`{"html":"a"}`)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	replay, err := requester.NewArchive(dir, requester.ArchiveReplay)
+	if err != nil {
+		t.Fatalf("NewArchive() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		reqBody []byte
+		want    string
+		wantErr error
+	}{
+		{name: "get", method: "GET", url: "https://example.com/post/", want: "<html>post</html>"},
+		{name: "post", method: "POST", url: "https://example.com/search", reqBody: []byte("q=a"), want: `{"html":"a"}`},
+		{name: "other body", method: "POST", url: "https://example.com/search", reqBody: []byte("q=b"), wantErr: requester.ErrNotArchived},
+		{name: "other method", method: "POST", url: "https://example.com/post/", wantErr: requester.ErrNotArchived},
+		{name: "missing", method: "GET", url: "https://example.com/other/", wantErr: requester.ErrNotArchived},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replay.Load(tt.method, tt.url, tt.reqBody)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Load() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewArchive(t *testing.T) {
+	if _, err := requester.NewArchive(t.TempDir()+"/missing", requester.ArchiveReplay); err == nil {
+		t.Errorf("NewArchive() replaying a missing directory, want error")
+	}
+	if _, err := requester.NewArchive(t.TempDir(), "rewind"); err == nil {
+		t.Errorf("NewArchive() with unknown mode, want error")
+	}
+}
+
+// pageTransport answers every request with the same page.
+type pageTransport struct {
+	calls atomic.Int32
+}
+
+func (t *pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("<html><body>page</body></html>")),
+		Request:    req,
+	}, nil
+}
+
+func Test_ArchiveRecordBypassesCache(t *testing.T) {
+	transport := &pageTransport{}
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(transport)
+
+	// the page is in the short-lived cache, but must still be recorded
+	if _, err := req.GetDocument(context.Background(), "https://example.com/post/"); err != nil {
+		t.Fatalf("GetDocument() error = %v", err)
+	}
+	dir := t.TempDir()
+	record, err := requester.NewArchive(dir, requester.ArchiveRecord)
+	if err != nil {
+		t.Fatalf("NewArchive() error = %v", err)
+	}
+	req.SetArchive(record)
+	if !req.BypassesCache() {
+		t.Fatalf("BypassesCache() while recording = false, want true")
+	}
+	if _, err := req.GetDocument(context.Background(), "https://example.com/post/"); err != nil {
+		t.Fatalf("GetDocument() error = %v", err)
+	}
+	if got := transport.calls.Load(); got != 2 {
+		t.Errorf("requests sent = %d, want 2", got)
+	}
+
+	replay, _ := requester.NewArchive(dir, requester.ArchiveReplay)
+	if _, err := replay.Load("GET", "https://example.com/post/", nil); err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+}
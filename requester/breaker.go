@@ -0,0 +1,188 @@
+package requester
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request when the upstream
+// failed too many times in a row and is given time to recover.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of the circuit breaker of an upstream.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every request at once until the open timeout passes.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe request through, closing the
+	// circuit if it succeeds and opening it again if it fails.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// BreakerConfig configures the circuit breakers.
+type BreakerConfig struct {
+	Failures    int           // consecutive failures that open the circuit, 0 disables the breaker
+	OpenTimeout time.Duration // time the circuit stays open before a probe is let through
+}
+
+// DefaultBreakerConfig is used until another config is set.
+var DefaultBreakerConfig = BreakerConfig{Failures: 5, OpenTimeout: time.Minute}
+
+// circuitBreaker is the breaker of a single upstream. It is safe for concurrent use.
+type circuitBreaker struct {
+	name      string
+	config    BreakerConfig
+	onChange  func(name string, state CircuitState)
+	isFailure func(err error) bool // whether the error counts against the upstream
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, config BreakerConfig, onChange func(string, CircuitState), isFailure func(error) bool) *circuitBreaker {
+	return &circuitBreaker{name: name, config: config, onChange: onChange, isFailure: isFailure, state: CircuitClosed}
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent.
+func (b *circuitBreaker) allow() error {
+	if b.config.Failures <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record records the outcome of a request let through by allow. The errors
+// that do not count against the upstream leave the failures as they are.
+func (b *circuitBreaker) record(err error) {
+	if b.config.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) || !b.isFailure(err)) {
+		return
+	}
+	if err == nil {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.config.Failures {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// current returns the state of the breaker, reporting an open circuit whose
+// timeout passed as half-open.
+func (b *circuitBreaker) current() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// setState changes the state, notifying the handler. The caller must hold the lock.
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(b.name, state)
+	}
+}
+
+// isHostFailure reports whether the error means the host is down or
+// overloaded. The challenges, invalid pages and 4xx answers come from a host
+// that is up, and FlareSolverr being down has a breaker of its own.
+func isHostFailure(err error) bool {
+	switch newFetchError("", err).Class {
+	case ClassDNS, ClassConnectionRefused, ClassTimeout, ClassUnavailable, ClassServerError, ClassTruncated:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetBreakerConfig sets the config of the circuit breakers of the hosts and
+// of FlareSolverr. It must be called before the first request.
+func (i *Requster) SetBreakerConfig(config BreakerConfig) {
+	i.mu.Lock()
+	i.breakerConfig = config
+	i.mu.Unlock()
+	i.fs.SetBreakerConfig(config)
+}
+
+// SetCircuitStateHandler sets the function called when the circuit breaker
+// of a host, or of FlareSolverr, changes state.
+func (i *Requster) SetCircuitStateHandler(fn func(upstream string, state CircuitState)) {
+	i.mu.Lock()
+	i.onCircuitState = fn
+	i.mu.Unlock()
+	i.fs.SetCircuitStateHandler(fn)
+}
+
+// CircuitState returns the state of the circuit breaker of the host of the URL.
+func (i *Requster) CircuitState(url string) CircuitState {
+	i.mu.Lock()
+	breaker, ok := i.breakers[hostOf(url)]
+	i.mu.Unlock()
+	if !ok {
+		return CircuitClosed
+	}
+	return breaker.current()
+}
+
+// FlareSolverrCircuitState returns the state of the circuit breaker of FlareSolverr.
+func (i *Requster) FlareSolverrCircuitState() CircuitState {
+	return i.fs.CircuitState()
+}
+
+// breakerFor returns the circuit breaker of the host of the URL, creating it if needed.
+func (i *Requster) breakerFor(url string) *circuitBreaker {
+	host := hostOf(url)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.breakers == nil {
+		i.breakers = make(map[string]*circuitBreaker)
+	}
+	breaker, ok := i.breakers[host]
+	if !ok {
+		breaker = newCircuitBreaker(host, i.breakerConfig, i.onCircuitState, isHostFailure)
+		i.breakers[host] = breaker
+	}
+	return breaker
+}
@@ -0,0 +1,107 @@
+package requester_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// flakyTransport refuses every connection while down is set, and answers
+// 403 while forbidden is set.
+type flakyTransport struct {
+	down      atomic.Bool
+	forbidden atomic.Bool
+	calls     atomic.Int32
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	if t.down.Load() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	status := http.StatusOK
+	if t.forbidden.Load() {
+		status = http.StatusForbidden
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader("ok")),
+		Request:    req,
+	}, nil
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	transport := &flakyTransport{}
+	transport.down.Store(true)
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(transport)
+	req.SetBreakerConfig(requester.BreakerConfig{Failures: 2, OpenTimeout: 50 * time.Millisecond})
+
+	var states []requester.CircuitState
+	req.SetCircuitStateHandler(func(upstream string, state requester.CircuitState) {
+		if upstream == "example.com" {
+			states = append(states, state)
+		}
+	})
+
+	do := func() error {
+		r, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+		_, err := req.Do(r)
+		return err
+	}
+
+	for range 2 {
+		if err := do(); err == nil || errors.Is(err, requester.ErrCircuitOpen) {
+			t.Fatalf("Do() error = %v, want the transport error", err)
+		}
+	}
+	if got := req.CircuitState("https://example.com/post/"); got != requester.CircuitOpen {
+		t.Fatalf("CircuitState() = %v, want %v", got, requester.CircuitOpen)
+	}
+	if err := do(); !errors.Is(err, requester.ErrCircuitOpen) {
+		t.Fatalf("Do() with an open circuit error = %v, want %v", err, requester.ErrCircuitOpen)
+	}
+	if got := transport.calls.Load(); got != 2 {
+		t.Errorf("requests sent = %d, want 2", got)
+	}
+	if got := req.CircuitState("https://other.example/"); got != requester.CircuitClosed {
+		t.Errorf("CircuitState() of another host = %v, want %v", got, requester.CircuitClosed)
+	}
+
+	// after the timeout a probe is let through and closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	transport.down.Store(false)
+	if err := do(); err != nil {
+		t.Fatalf("Do() probe error = %v", err)
+	}
+	if got := req.CircuitState("https://example.com/"); got != requester.CircuitClosed {
+		t.Errorf("CircuitState() after the probe = %v, want %v", got, requester.CircuitClosed)
+	}
+
+	want := []requester.CircuitState{requester.CircuitOpen, requester.CircuitHalfOpen, requester.CircuitClosed}
+	if !slices.Equal(states, want) {
+		t.Errorf("state changes = %v, want %v", states, want)
+	}
+
+	// the site answering with an error of its own is not a failure of the host
+	transport.forbidden.Store(true)
+	for range 3 {
+		if _, err := req.GetDocument(context.Background(), "https://example.com/forbidden"); err == nil {
+			t.Fatalf("GetDocument() of a forbidden page, want error")
+		}
+	}
+	if got := req.CircuitState("https://example.com/"); got != requester.CircuitClosed {
+		t.Errorf("CircuitState() after 403 answers = %v, want %v", got, requester.CircuitClosed)
+	}
+}
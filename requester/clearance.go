@@ -0,0 +1,114 @@
+package requester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+const (
+	clearanceCacheKey = "clearance"
+	// clearanceDefaultExpiration is used when none of the cookies has an expiry.
+	clearanceDefaultExpiration = time.Hour
+	// clearanceCookie is the Cloudflare cookie telling the challenge was solved.
+	clearanceCookie = "cf_clearance"
+)
+
+// Clearance is the outcome of a challenge solved by FlareSolverr: the cookies
+// set by the site and the user agent they are bound to.
+type Clearance struct {
+	UserAgent string         `json:"user_agent"`
+	Cookies   []*http.Cookie `json:"cookies"`
+	Expires   time.Time      `json:"expires"`
+}
+
+// clearanceOf returns the clearance of a FlareSolverr solution, which expires
+// with its clearance cookie, or with the first cookie to expire if there is none.
+func clearanceOf(response Response) Clearance {
+	c := Clearance{UserAgent: response.Solution.UserAgent}
+	var first, clearance time.Time
+	for _, cookie := range response.Solution.Cookies {
+		c.Cookies = append(c.Cookies, &http.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		})
+		if cookie.Expiry <= 0 {
+			continue
+		}
+		expiry := time.Unix(int64(cookie.Expiry), 0)
+		if cookie.Name == clearanceCookie {
+			clearance = expiry
+		}
+		if first.IsZero() || expiry.Before(first) {
+			first = expiry
+		}
+	}
+	switch {
+	case !clearance.IsZero():
+		c.Expires = clearance
+	case !first.IsZero():
+		c.Expires = first
+	default:
+		c.Expires = time.Now().Add(clearanceDefaultExpiration)
+	}
+	return c
+}
+
+// saveClearance persists the clearance solved for the URL, so the next
+// requests to its host are sent by the plain client.
+func (i *Requster) saveClearance(ctx context.Context, url string, c Clearance) {
+	ttl := time.Until(c.Expires)
+	if len(c.Cookies) == 0 || c.UserAgent == "" || ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	host := hostOf(url)
+	if err := i.c.SetWithExpiration(ctx, clearanceKey(host), data, ttl); err != nil {
+		logging.Error().Err(err).Str("host", host).Msg("Failed to save clearance to cache")
+		return
+	}
+	logging.Debug().Str("host", host).Dur("ttl", ttl).Msg("Saved FlareSolverr clearance")
+}
+
+// applyClearance adds the clearance cookies of the host of the request, and
+// the user agent they are bound to. It reports whether there was one.
+func (i *Requster) applyClearance(ctx context.Context, req *http.Request) bool {
+	data, err := i.c.Get(ctx, clearanceKey(hostOf(req.URL.String())))
+	if err != nil {
+		return false
+	}
+	var c Clearance
+	if err := json.Unmarshal(data, &c); err != nil || time.Now().After(c.Expires) {
+		return false
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	for _, cookie := range c.Cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return true
+}
+
+// expireClearance forgets the clearance of the host of the URL, after the
+// site challenged a request that carried it.
+func (i *Requster) expireClearance(ctx context.Context, url string) {
+	host := hostOf(url)
+	if err := i.c.Del(ctx, clearanceKey(host)); err != nil {
+		logging.Error().Err(err).Str("host", host).Msg("Failed to delete clearance from cache")
+	}
+	logging.Debug().Str("host", host).Msg("Clearance expired, solving the challenge again")
+}
+
+func clearanceKey(host string) string {
+	return fmt.Sprintf("%s:%s", clearanceCacheKey, host)
+}
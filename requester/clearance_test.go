@@ -0,0 +1,91 @@
+package requester_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// challengeTransport challenges the requests without the clearance cookie
+// and the user agent it is bound to.
+type challengeTransport struct{}
+
+func (challengeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := "<html><head><title>Just a moment...</title></head></html>"
+	if cookie, err := req.Cookie("cf_clearance"); err == nil && cookie.Value == "solved" && req.UserAgent() == "solver-agent" {
+		body = "<html><body>plain " + req.URL.Path + "</body></html>"
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func newFakeFlareSolverr(t *testing.T, solves *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cmd map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&cmd)
+		switch cmd["cmd"] {
+		case "sessions.list":
+			_, _ = io.WriteString(w, `{"sessions": ["s1"]}`)
+		case "sessions.create":
+			_, _ = io.WriteString(w, `{"session": "s2"}`)
+		case "request.get":
+			solves.Add(1)
+			expiry := time.Now().Add(time.Hour).Unix()
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"status": "ok",
+				"solution": map[string]any{
+					"url":       cmd["url"],
+					"status":    200,
+					"userAgent": "solver-agent",
+					"cookies":   []map[string]any{{"name": "cf_clearance", "value": "solved", "domain": ".example.com", "expiry": expiry}},
+					"response":  "<html><body>solved</body></html>",
+				},
+			})
+		default:
+			t.Errorf("unexpected FlareSolverr command %v", cmd["cmd"])
+		}
+	}))
+}
+
+func Test_ClearanceReuse(t *testing.T) {
+	var solves atomic.Int32
+	server := newFakeFlareSolverr(t, &solves)
+	defer server.Close()
+
+	req := requester.NewRequester(requester.NewFlareSolverr(server.URL, 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(challengeTransport{})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com/first", want: "solved"},
+		{url: "https://example.com/second", want: "plain /second"},
+		{url: "https://example.com/third", want: "plain /third"},
+	}
+	for _, tt := range tests {
+		body, err := req.GetDocument(context.Background(), tt.url)
+		if err != nil {
+			t.Fatalf("GetDocument(%s) error = %v", tt.url, err)
+		}
+		got, _ := io.ReadAll(body)
+		if !strings.Contains(string(got), tt.want) {
+			t.Errorf("GetDocument(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if got := solves.Load(); got != 1 {
+		t.Errorf("challenges solved by FlareSolverr = %d, want 1", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +15,8 @@ import (
 	"time"
 
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/proxy"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 )
 
@@ -21,164 +24,78 @@ type FlareSolverr struct {
 	url         string
 	maxTimeout  int
 	httpClient  *http.Client
-	sessionPool chan string
+	poolConfig  SessionPoolConfig
+	sessionPool chan *session
 	mu          sync.Mutex
+	initMu      sync.Mutex // serializes the fills of the pool
 	initiated   bool
+	lastInit    time.Time // last attempt to fill the pool
+	sessions    int       // sessions owned by the pool, idle or in use
+	inUse       int
+	metrics     *monitoring.Metrics
+	breaker     *circuitBreaker
+	breakerCfg  BreakerConfig
+	onCircuit   func(upstream string, state CircuitState)
+	onSolved    func(ctx context.Context, url string, c Clearance)
 }
 
 var (
 	ErrListSessions = fmt.Errorf("failed to list sessions")
+	// ErrFlareSolverrUnavailable is returned when FlareSolverr itself could not be reached.
+	ErrFlareSolverrUnavailable = errors.New("flaresolverr is unavailable")
 )
 
+// flareSolverrUpstream is the name of FlareSolverr in the circuit breaker metrics.
+const flareSolverrUpstream = "flaresolverr"
+
+// NewFlareSolverr returns the client of the FlareSolverr at url, or of none
+// if url is empty. The session pool is filled by Start, or by the first request.
 func NewFlareSolverr(url string, timeoutMilli int) *FlareSolverr {
-	poolSize := 5
 	httpClient := &http.Client{
 		Timeout: time.Duration(timeoutMilli) * time.Millisecond,
 	}
-	sessionPool := make(chan string, poolSize) // Pool size of 5 sessions
 
-	f := &FlareSolverr{
+	return &FlareSolverr{
 		url:         url,
 		maxTimeout:  timeoutMilli,
 		httpClient:  httpClient,
-		sessionPool: sessionPool,
-	}
-
-	err := f.FillSessionPool()
-	if err == nil {
-		f.initiated = true
-	}
-
-	return f
-}
-
-func (f *FlareSolverr) FillSessionPool() error {
-	// Check if the pool is already filled
-	if len(f.sessionPool) == cap(f.sessionPool) {
-		return nil
-	}
-
-	// Pre-initialize the pool with existing sessions
-	sessions, err := f.ListSessions()
-	if err != nil {
-		// if fail to list sessions, it may not support the sessions.list command
-		// create new dumb sessions to fill the pool
-		if err == ErrListSessions {
-			for len(f.sessionPool) < cap(f.sessionPool) {
-				f.sessionPool <- "dumb-session"
-			}
-			return nil
-		}
-		logging.Error().Err(err).Msg("Failed to list existing FlareSolverr sessions")
-		return err
-	} else {
-		for _, session := range sessions {
-			// Add available sessions to the pool
-			if len(f.sessionPool) < cap(f.sessionPool) {
-				f.sessionPool <- session
-			}
-		}
-		if len(f.sessionPool) > 0 {
-			logging.Info().Int("sessions", len(f.sessionPool)).Msg("Added FlareSolverr sessions to the pool")
-		}
-	}
-
-	// If fewer than poolSize sessions were found, create new ones to fill the pool
-	for len(f.sessionPool) < cap(f.sessionPool) {
-		f.CreateSession()
+		poolConfig:  DefaultSessionPoolConfig,
+		sessionPool: make(chan *session, DefaultSessionPoolConfig.Size),
+		breaker:     newCircuitBreaker(flareSolverrUpstream, DefaultBreakerConfig, nil, isFlareSolverrFailure),
+		breakerCfg:  DefaultBreakerConfig,
 	}
-
-	return nil
 }
 
-func (f *FlareSolverr) CreateSession() string {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	body := map[string]string{"cmd": "sessions.create"}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return ""
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1", f.url), bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return ""
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := f.httpClient.Do(req)
-	if err != nil {
-		return ""
-	}
-
-	defer resp.Body.Close()
-
-	var sessionResponse map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&sessionResponse)
-	if err != nil {
-		return ""
+// flareSolverrProxy returns the proxy parameter of FlareSolverr, which takes
+// the credentials apart from the URL.
+func flareSolverrProxy(u *url.URL) map[string]string {
+	scheme := u.Scheme
+	if scheme == "socks5h" {
+		scheme = "socks5"
 	}
-
-	session, ok := sessionResponse["session"].(string)
-	if !ok {
-		logging.Error().Msg("Failed to create FlareSolverr session")
-		return ""
+	param := map[string]string{"url": scheme + "://" + u.Host}
+	if u.User != nil {
+		param["username"] = u.User.Username()
+		param["password"], _ = u.User.Password()
 	}
-	// Add session to the pool
-	f.sessionPool <- session
-
-	logging.Info().Str("session", session).Msg("Created new FlareSolverr session")
-	return session
+	return param
 }
 
-func (f *FlareSolverr) ListSessions() ([]string, error) {
-	body := map[string]string{"cmd": "sessions.list"}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1", f.url), bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
+// proxyErrors are the errors of Chrome telling the proxy, not the site, failed.
+var proxyErrors = []string{"ERR_PROXY_", "ERR_TUNNEL_CONNECTION_FAILED", "ERR_SOCKS_"}
 
-	resp, err := f.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// reportProxy reports the outcome of a request FlareSolverr made through the
+// proxy to its pool. The failures of the site are not counted.
+func reportProxy(pool *proxy.Pool, u *url.URL, response Response) {
+	if response.Status == "ok" {
+		pool.ReportSuccess(u)
+		return
 	}
-
-	defer resp.Body.Close()
-
-	var sessionsResponse map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&sessionsResponse)
-	if err != nil {
-		return nil, err
-	}
-	if sessionsResponse["sessions"] == nil {
-		return nil, ErrListSessions
-	}
-
-	sessions := sessionsResponse["sessions"].([]interface{})
-	var sessionIDs []string
-	for _, session := range sessions {
-		sessionIDs = append(sessionIDs, session.(string))
-	}
-
-	return sessionIDs, nil
-}
-
-func (f *FlareSolverr) RetrieveSession(ctx context.Context) (string, error) {
-	// Blocking receive from the session pool.
-	select {
-	case session := <-f.sessionPool:
-		return session, nil
-	case <-ctx.Done():
-		return "", ctx.Err()
+	for _, proxyErr := range proxyErrors {
+		if strings.Contains(response.Message, proxyErr) {
+			pool.ReportFailure(u, errors.New(response.Message))
+			return
+		}
 	}
 }
 
@@ -204,29 +121,113 @@ type Response struct {
 	} `json:"solution"`
 }
 
+// SetBreakerConfig sets the config of the circuit breaker of FlareSolverr.
+// It must be called before the first request.
+func (f *FlareSolverr) SetBreakerConfig(config BreakerConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.breakerCfg = config
+	f.breaker = newCircuitBreaker(flareSolverrUpstream, config, f.onCircuit, isFlareSolverrFailure)
+}
+
+// SetCircuitStateHandler sets the function called when the circuit breaker
+// of FlareSolverr changes state. It must be called before the first request.
+func (f *FlareSolverr) SetCircuitStateHandler(fn func(upstream string, state CircuitState)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onCircuit = fn
+	f.breaker = newCircuitBreaker(flareSolverrUpstream, f.breakerCfg, fn, isFlareSolverrFailure)
+}
+
+// SetClearanceHandler sets the function called with the cookies and user
+// agent of each challenge solved, so they can be reused without FlareSolverr.
+func (f *FlareSolverr) SetClearanceHandler(fn func(ctx context.Context, url string, c Clearance)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onSolved = fn
+}
+
+// CircuitState returns the state of the circuit breaker of FlareSolverr.
+func (f *FlareSolverr) CircuitState() CircuitState {
+	return f.breaker.current()
+}
+
+// Get solves the URL with FlareSolverr. While FlareSolverr keeps failing to
+// answer, the requests fail at once with ErrCircuitOpen instead of tying up
+// the session pool.
 func (f *FlareSolverr) Get(ctx context.Context, _url string, attempts int) (io.ReadCloser, error) {
-	// Check if the FlareSolverr instance was initiated
-	if !f.initiated {
+	// FlareSolverr is not configured
+	if f.url == "" {
 		return io.NopCloser(bytes.NewReader([]byte(""))), nil
 	}
 
-	// Retrieve session from the pool (blocking if no sessions available)
-	session, err := f.RetrieveSession(ctx)
-	if err != nil {
-		return nil, err
+	if err := f.breaker.allow(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFlareSolverrUnavailable, err)
+	}
+	// FlareSolverr may have come up after the indexer. While the pool can not
+	// be filled, e.g. when it does not support sessions, the requests are made
+	// without one, and fail on their own if FlareSolverr is down
+	if err := f.ensureInitiated(); err != nil {
+		logging.Debug().Err(err).Msg("FlareSolverr session pool is empty, requesting without a session")
 	}
 
-	// Ensure the session is returned to the pool after the request is done
-	defer func() {
-		f.sessionPool <- session
-	}()
+	start := time.Now()
+	body, err := f.get(ctx, _url, attempts)
+	f.observeSolve(time.Since(start), err)
+	if isFlareSolverrFailure(err) {
+		f.breaker.record(err)
+	} else {
+		// FlareSolverr answered, even if the site did not
+		f.breaker.record(nil)
+	}
+	return body, err
+}
 
+// isFlareSolverrFailure reports whether the error means FlareSolverr itself failed.
+func isFlareSolverrFailure(err error) bool {
+	return errors.Is(err, ErrFlareSolverrUnavailable)
+}
+
+func (f *FlareSolverr) get(ctx context.Context, _url string, attempts int) (io.ReadCloser, error) {
 	body := map[string]interface{}{
 		"cmd":        "request.get",
 		"url":        _url,
 		"maxTimeout": f.maxTimeout,
-		"session":    session,
 	}
+
+	// FlareSolverr ignores the proxy of the requests made with a session, so
+	// the proxied requests are made without one, in a browser of their own
+	var (
+		s        *session
+		proxyURL *url.URL
+	)
+	pool := proxy.For(_url)
+	if pool != nil {
+		u, err := pool.Next()
+		if err != nil {
+			return nil, err
+		}
+		proxyURL = u
+		body["proxy"] = flareSolverrProxy(u)
+	} else if f.hasSessions() {
+		// Retrieve session from the pool (blocking if no sessions available)
+		var err error
+		s, err = f.acquireSession(ctx)
+		if err != nil {
+			return nil, err
+		}
+		body["session"] = s.id
+	}
+
+	// Ensure the session is returned to the pool after the request is done,
+	// counting the requests FlareSolverr failed to solve against it
+	failed, released := false, false
+	defer func() {
+		if s != nil && !released {
+			f.releaseSession(s, failed)
+		}
+	}()
+
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
@@ -241,32 +242,47 @@ func (f *FlareSolverr) Get(ctx context.Context, _url string, attempts int) (io.R
 
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrFlareSolverrUnavailable, err)
 	}
+	defer resp.Body.Close()
 
 	// Parse the response
 	var response Response
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrFlareSolverrUnavailable, err)
+	}
+
+	if pool != nil {
+		reportProxy(pool, proxyURL, response)
 	}
 
 	// Check if the response was successful
 	if response.Status != "ok" {
 		// if is 500 Internal Server Error, recursively call the Get method
 		if resp.StatusCode == http.StatusInternalServerError && attempts != 0 {
+			// give the session back first, the retry may need it
+			if s != nil {
+				f.releaseSession(s, true)
+				released = true
+			}
 			attempts--
 			logging.Warn().Str("url", _url).Int("attempts_left", attempts).Msg("FlareSolverr Internal Server Error, retrying")
-			return f.Get(ctx, _url, attempts) // Retry the request
+			return f.get(ctx, _url, attempts) // Retry the request
 		}
 
+		failed = true
 		// log the http status code
 		return nil, fmt.Errorf("failed to get response: %s, statusCode: %s", response.Message, resp.Status)
 	}
 
 	// Check if "Under attack" is in the response
 	if strings.Contains(response.Solution.Response, "Under attack") {
-		return nil, fmt.Errorf("under attack")
+		return nil, fmt.Errorf("%w: under attack", ErrChallenge)
+	}
+
+	if len(response.Solution.Cookies) > 0 && f.onSolved != nil {
+		f.onSolved(ctx, _url, clearanceOf(response))
 	}
 
 	// check if the response is valid HTML
@@ -0,0 +1,396 @@
+package requester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+)
+
+// reinitInterval is the minimum time between two attempts of the requests to
+// fill the pool while FlareSolverr is down.
+const reinitInterval = 10 * time.Second
+
+// SessionPoolConfig configures the FlareSolverr session pool.
+type SessionPoolConfig struct {
+	Size                int           // sessions kept open, each solving one request at a time
+	MaxFailures         int           // consecutive failed solves after which a session is recreated, 0 for never
+	MaxAge              time.Duration // age after which a session is recreated, 0 for never
+	HealthCheckInterval time.Duration // time between the health checks of Start, 0 disables them
+}
+
+// DefaultSessionPoolConfig is used until another config is set.
+var DefaultSessionPoolConfig = SessionPoolConfig{
+	Size:                5,
+	MaxFailures:         3,
+	MaxAge:              30 * time.Minute,
+	HealthCheckInterval: time.Minute,
+}
+
+// session is a FlareSolverr session, a browser instance keeping its cookies
+// between requests.
+type session struct {
+	id       string
+	created  time.Time
+	failures int // consecutive failed solves
+}
+
+// SetSessionPoolConfig sets the config of the session pool.
+// It must be called before Start and the first request.
+func (f *FlareSolverr) SetSessionPoolConfig(config SessionPoolConfig) {
+	if config.Size < 1 {
+		config.Size = 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.poolConfig = config
+	f.sessionPool = make(chan *session, config.Size)
+}
+
+// SetMetrics exports the utilisation of the session pool, the time waited for
+// a session and the duration of the solves.
+func (f *FlareSolverr) SetMetrics(metrics *monitoring.Metrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metrics = metrics
+	f.observePool()
+}
+
+// Start fills the session pool and checks the health of FlareSolverr
+// periodically until the context is done: filling the pool when FlareSolverr
+// comes up, recreating the sessions it lost, e.g. when it was restarted, and
+// the ones too old.
+func (f *FlareSolverr) Start(ctx context.Context) {
+	if f.url == "" {
+		return
+	}
+	if err := f.fillSessionPool(); err != nil {
+		logging.Error().Err(err).Msg("Failed to fill the FlareSolverr session pool, retrying later")
+	}
+	if f.poolConfig.HealthCheckInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(f.poolConfig.HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f.checkHealth()
+			}
+		}
+	}()
+}
+
+// checkHealth lists the sessions of FlareSolverr, which also tells whether it
+// is up, drops the idle sessions it no longer has, refills the pool and
+// recreates the idle sessions that are too old.
+func (f *FlareSolverr) checkHealth() {
+	f.mu.Lock()
+	initiated := f.initiated
+	f.mu.Unlock()
+
+	listed := time.Now()
+	ids, err := f.ListSessions()
+	if err != nil && err != ErrListSessions {
+		logging.Warn().Err(err).Msg("FlareSolverr health check failed")
+		return
+	}
+	if initiated && err == nil {
+		f.dropLostSessions(ids, listed)
+	}
+
+	if err := f.fillSessionPool(); err != nil {
+		logging.Warn().Err(err).Msg("FlareSolverr health check failed")
+		return
+	}
+	if !initiated {
+		logging.Info().Msg("FlareSolverr is up, session pool filled")
+	}
+
+	for range len(f.sessionPool) {
+		select {
+		case s := <-f.sessionPool:
+			if f.sessionExpired(s) {
+				go f.recycleSession(s, "age")
+			} else {
+				f.sessionPool <- s
+			}
+		default:
+		}
+	}
+}
+
+// dropLostSessions removes from the pool the idle sessions missing from the
+// sessions listed by FlareSolverr, so the next fill recreates them. The
+// sessions created after the list are kept, and the ones in use are checked
+// by the next health check.
+func (f *FlareSolverr) dropLostSessions(ids []string, listed time.Time) {
+	alive := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		alive[id] = true
+	}
+
+	lost := 0
+	for range len(f.sessionPool) {
+		select {
+		case s := <-f.sessionPool:
+			if alive[s.id] || s.created.After(listed) {
+				f.sessionPool <- s
+			} else {
+				lost++
+			}
+		default:
+		}
+	}
+	if lost == 0 {
+		return
+	}
+	logging.Warn().Int("sessions", lost).Msg("FlareSolverr lost sessions of the pool, recreating them")
+	f.mu.Lock()
+	f.sessions -= lost
+	f.observePool()
+	f.mu.Unlock()
+}
+
+// ensureInitiated fills the pool if it is empty, at most once every
+// reinitInterval, returning ErrFlareSolverrUnavailable if it fails.
+func (f *FlareSolverr) ensureInitiated() error {
+	f.mu.Lock()
+	ready := f.initiated && f.sessions > 0
+	tooSoon := time.Since(f.lastInit) < reinitInterval
+	f.mu.Unlock()
+
+	if ready {
+		return nil
+	}
+	if tooSoon {
+		return fmt.Errorf("%w: no sessions available", ErrFlareSolverrUnavailable)
+	}
+	if err := f.fillSessionPool(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFlareSolverrUnavailable, err)
+	}
+	return nil
+}
+
+// fillSessionPool adds the existing sessions to the pool, then creates new
+// ones until it has its size.
+func (f *FlareSolverr) fillSessionPool() error {
+	f.initMu.Lock()
+	defer f.initMu.Unlock()
+
+	f.mu.Lock()
+	f.lastInit = time.Now()
+	missing := f.poolConfig.Size - f.sessions
+	initiated := f.initiated
+	f.mu.Unlock()
+	if missing <= 0 {
+		return nil
+	}
+
+	// adopt the sessions left by a previous run, unless some are already in use
+	if !initiated {
+		ids, err := f.ListSessions()
+		if err != nil && err != ErrListSessions {
+			return err
+		}
+		for _, id := range ids {
+			if missing == 0 {
+				break
+			}
+			f.addSession(&session{id: id, created: time.Now()})
+			missing--
+		}
+		if len(ids) > 0 {
+			logging.Info().Int("sessions", len(ids)).Msg("Added existing FlareSolverr sessions to the pool")
+		}
+	}
+
+	for ; missing > 0; missing-- {
+		s, err := f.createSession()
+		if err != nil {
+			return err
+		}
+		f.addSession(s)
+	}
+	return nil
+}
+
+// hasSessions reports whether the pool owns any session, idle or in use.
+func (f *FlareSolverr) hasSessions() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions > 0
+}
+
+// addSession adds a new session to the pool.
+func (f *FlareSolverr) addSession(s *session) {
+	f.mu.Lock()
+	f.sessions++
+	f.initiated = true
+	f.observePool()
+	f.mu.Unlock()
+	f.sessionPool <- s
+}
+
+// acquireSession takes a session from the pool, blocking until one is available.
+func (f *FlareSolverr) acquireSession(ctx context.Context) (*session, error) {
+	start := time.Now()
+	select {
+	case s := <-f.sessionPool:
+		f.mu.Lock()
+		f.inUse++
+		f.observePool()
+		f.mu.Unlock()
+		if f.metrics != nil {
+			f.metrics.FlareSolverrSessionWait.Observe(time.Since(start).Seconds())
+		}
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaseSession gives the session back to the pool, or recreates it if it
+// failed too many times in a row or is too old.
+func (f *FlareSolverr) releaseSession(s *session, failed bool) {
+	f.mu.Lock()
+	f.inUse--
+	f.observePool()
+	maxFailures := f.poolConfig.MaxFailures
+	f.mu.Unlock()
+
+	if failed {
+		s.failures++
+	} else {
+		s.failures = 0
+	}
+	switch {
+	case maxFailures > 0 && s.failures >= maxFailures:
+		go f.recycleSession(s, "failures")
+	case f.sessionExpired(s):
+		go f.recycleSession(s, "age")
+	default:
+		f.sessionPool <- s
+	}
+}
+
+// sessionExpired reports whether the session is older than the max age.
+func (f *FlareSolverr) sessionExpired(s *session) bool {
+	return f.poolConfig.MaxAge > 0 && time.Since(s.created) > f.poolConfig.MaxAge
+}
+
+// recycleSession destroys the session and puts a new one in its place. If
+// the new one can not be created, the pool shrinks until the health check
+// or the next request refills it.
+func (f *FlareSolverr) recycleSession(s *session, reason string) {
+	logging.Info().Str("session", s.id).Str("reason", reason).Int("failures", s.failures).Msg("Recreating FlareSolverr session")
+	if f.metrics != nil {
+		f.metrics.FlareSolverrSessionsRecycled.WithLabelValues(reason).Inc()
+	}
+	if err := f.destroySession(s.id); err != nil {
+		logging.Warn().Err(err).Str("session", s.id).Msg("Failed to destroy FlareSolverr session")
+	}
+
+	created, err := f.createSession()
+	if err != nil {
+		logging.Error().Err(err).Msg("Failed to recreate FlareSolverr session")
+		f.mu.Lock()
+		f.sessions--
+		f.observePool()
+		f.mu.Unlock()
+		return
+	}
+	f.sessionPool <- created
+}
+
+// observePool updates the size and utilisation gauges. The caller must hold the lock.
+func (f *FlareSolverr) observePool() {
+	if f.metrics != nil {
+		f.metrics.FlareSolverrPoolSize.Set(float64(f.sessions))
+		f.metrics.FlareSolverrSessionsInUse.Set(float64(f.inUse))
+	}
+}
+
+// observeSolve records the duration of a request to FlareSolverr.
+func (f *FlareSolverr) observeSolve(duration time.Duration, err error) {
+	if f.metrics == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	f.metrics.FlareSolverrSolveDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+func (f *FlareSolverr) createSession() (*session, error) {
+	var sessionResponse map[string]interface{}
+	if err := f.command(map[string]string{"cmd": "sessions.create"}, &sessionResponse); err != nil {
+		return nil, err
+	}
+
+	id, ok := sessionResponse["session"].(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to create FlareSolverr session: %v", sessionResponse["message"])
+	}
+	logging.Info().Str("session", id).Msg("Created new FlareSolverr session")
+	return &session{id: id, created: time.Now()}, nil
+}
+
+func (f *FlareSolverr) destroySession(id string) error {
+	var response map[string]interface{}
+	return f.command(map[string]string{"cmd": "sessions.destroy", "session": id}, &response)
+}
+
+func (f *FlareSolverr) ListSessions() ([]string, error) {
+	var sessionsResponse map[string]interface{}
+	if err := f.command(map[string]string{"cmd": "sessions.list"}, &sessionsResponse); err != nil {
+		return nil, err
+	}
+	if sessionsResponse["sessions"] == nil {
+		return nil, ErrListSessions
+	}
+
+	sessions, _ := sessionsResponse["sessions"].([]interface{})
+	var sessionIDs []string
+	for _, session := range sessions {
+		if id, ok := session.(string); ok {
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	return sessionIDs, nil
+}
+
+// command sends a command to FlareSolverr and decodes its response into out.
+func (f *FlareSolverr) command(body map[string]string, out any) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1", f.url), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,180 @@
+package requester_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// fakeSessionServer is a FlareSolverr that can be down or restarted, whose
+// solves fail while failing is set and which refuses to create sessions while
+// noSessions is set.
+type fakeSessionServer struct {
+	up          atomic.Bool
+	failing     atomic.Bool
+	noSessions  atomic.Bool
+	created     atomic.Int32
+	destroyed   atomic.Int32
+	sessionless atomic.Int32 // solves requested without a session
+	mu          sync.Mutex
+	sessions    []string
+}
+
+// restart loses every session.
+func (s *fakeSessionServer) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = nil
+}
+
+func (s *fakeSessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.up.Load() {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	var cmd map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&cmd)
+	switch cmd["cmd"] {
+	case "sessions.list":
+		s.mu.Lock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"sessions": append([]string{}, s.sessions...)})
+		s.mu.Unlock()
+	case "sessions.create":
+		if s.noSessions.Load() {
+			_, _ = io.WriteString(w, `{"status": "error", "message": "Sessions are not supported"}`)
+			return
+		}
+		id := fmt.Sprintf("s%d", s.created.Add(1))
+		s.mu.Lock()
+		s.sessions = append(s.sessions, id)
+		s.mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"session": %q}`, id)
+	case "sessions.destroy":
+		s.destroyed.Add(1)
+		s.mu.Lock()
+		s.sessions = slices.DeleteFunc(s.sessions, func(id string) bool { return id == cmd["session"] })
+		s.mu.Unlock()
+		_, _ = io.WriteString(w, `{"status": "ok"}`)
+	case "request.get":
+		if cmd["session"] == nil {
+			s.sessionless.Add(1)
+		}
+		if s.failing.Load() {
+			_, _ = io.WriteString(w, `{"status": "error", "message": "Error solving the challenge"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"status": "ok", "solution": {"response": "<html><body>solved</body></html>"}}`)
+	}
+}
+
+// eventually polls the condition for up to a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for range 100 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func Test_FlareSolverrLazyInit(t *testing.T) {
+	fake := &fakeSessionServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fs := requester.NewFlareSolverr(server.URL, 1000)
+	fs.SetSessionPoolConfig(requester.SessionPoolConfig{Size: 2, HealthCheckInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs.Start(ctx)
+
+	if _, err := fs.Get(context.Background(), "https://example.com/", 0); !errors.Is(err, requester.ErrFlareSolverrUnavailable) {
+		t.Fatalf("Get() while FlareSolverr is down error = %v, want %v", err, requester.ErrFlareSolverrUnavailable)
+	}
+
+	// FlareSolverr comes up after the indexer
+	fake.up.Store(true)
+	eventually(t, "the pool to be filled", func() bool { return fake.created.Load() == 2 })
+	if _, err := fs.Get(context.Background(), "https://example.com/", 0); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+}
+
+func Test_FlareSolverrRecyclesFailingSessions(t *testing.T) {
+	fake := &fakeSessionServer{}
+	fake.up.Store(true)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fs := requester.NewFlareSolverr(server.URL, 1000)
+	fs.SetSessionPoolConfig(requester.SessionPoolConfig{Size: 1, MaxFailures: 2})
+
+	fake.failing.Store(true)
+	for range 2 {
+		if _, err := fs.Get(context.Background(), "https://example.com/", 0); err == nil {
+			t.Fatalf("Get() with a failing session, want error")
+		}
+	}
+	eventually(t, "the session to be recreated", func() bool {
+		return fake.destroyed.Load() == 1 && fake.created.Load() == 2
+	})
+
+	fake.failing.Store(false)
+	if _, err := fs.Get(context.Background(), "https://example.com/", 0); err != nil {
+		t.Fatalf("Get() with the new session error = %v", err)
+	}
+}
+
+func Test_FlareSolverrRecreatesLostSessions(t *testing.T) {
+	fake := &fakeSessionServer{}
+	fake.up.Store(true)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fs := requester.NewFlareSolverr(server.URL, 1000)
+	fs.SetSessionPoolConfig(requester.SessionPoolConfig{Size: 2, HealthCheckInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs.Start(ctx)
+	eventually(t, "the pool to be filled", func() bool { return fake.created.Load() == 2 })
+
+	// FlareSolverr restarts, losing the sessions of the pool
+	fake.restart()
+	eventually(t, "the lost sessions to be recreated", func() bool { return fake.created.Load() == 4 })
+	time.Sleep(50 * time.Millisecond)
+	if got := fake.created.Load(); got != 4 {
+		t.Errorf("sessions created = %d, want 4", got)
+	}
+}
+
+func Test_FlareSolverrWithoutSessions(t *testing.T) {
+	fake := &fakeSessionServer{}
+	fake.up.Store(true)
+	fake.noSessions.Store(true)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fs := requester.NewFlareSolverr(server.URL, 1000)
+	fs.SetSessionPoolConfig(requester.SessionPoolConfig{Size: 2})
+	for range 2 {
+		if _, err := fs.Get(context.Background(), "https://example.com/", 0); err != nil {
+			t.Fatalf("Get() without sessions error = %v", err)
+		}
+	}
+	if got := fake.sessionless.Load(); got != 2 {
+		t.Errorf("solves without a session = %d, want 2", got)
+	}
+}
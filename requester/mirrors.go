@@ -0,0 +1,231 @@
+package requester
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+const (
+	mirrorCacheKey        = "healthyMirror"
+	mirrorCacheExpiration = 30 * 24 * time.Hour
+)
+
+// ErrServerError is returned when the site answers with a 5xx status.
+var ErrServerError = errors.New("server error")
+
+// mirrorGroup is an ordered list of base URLs serving the same site.
+type mirrorGroup struct {
+	mirrors  []string // base URLs ending with "/", the primary first
+	current  string   // the mirror that last worked, empty if unknown
+	moved    []string // mirrors the site moved to, found at runtime
+	restored []string // moves loaded from the cache, reported once the site is served from them
+	rejected string   // the last "we moved to" banner target that could not be verified
+	loaded   bool     // whether current was loaded from the cache
+}
+
+// AddMirrors registers the base URLs of a site, the primary first. Requests
+// to any of them fail over to the others, in order, on DNS, TLS and refused
+// connection errors, 5xx statuses, unsolved challenges and open circuit breakers. The mirror that worked is remembered
+// in the cache and tried first by the next requests.
+// Sites with a single URL are registered too, so their domain moves are followed.
+func (i *Requster) AddMirrors(mirrors ...string) {
+	var group mirrorGroup
+	for _, mirror := range mirrors {
+		if mirror == "" {
+			continue
+		}
+		if !strings.HasSuffix(mirror, "/") {
+			mirror += "/"
+		}
+		if !slices.Contains(group.mirrors, mirror) {
+			group.mirrors = append(group.mirrors, mirror)
+		}
+	}
+	if len(group.mirrors) == 0 {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.mirrors = append(i.mirrors, &group)
+}
+
+// ResolveMirror rewrites a URL of a site with mirrors to the mirror that last
+// worked. Other URLs are returned unchanged.
+func (i *Requster) ResolveMirror(ctx context.Context, url string) string {
+	group, mirror := i.findMirror(url)
+	if group == nil {
+		return url
+	}
+	current := i.currentMirror(ctx, group)
+	return current + strings.TrimPrefix(url, mirror)
+}
+
+// mirrorCandidates returns the URLs to try for the request, starting with
+// the mirror that last worked.
+func (i *Requster) mirrorCandidates(ctx context.Context, url string) []string {
+	group, mirror := i.findMirror(url)
+	if group == nil {
+		return []string{url}
+	}
+	path := strings.TrimPrefix(url, mirror)
+
+	current := i.currentMirror(ctx, group)
+	candidates := []string{current + path}
+	for _, m := range group.mirrors {
+		if m != current {
+			candidates = append(candidates, m+path)
+		}
+	}
+	return candidates
+}
+
+// findMirror returns the group of the URL and the mirror it starts with.
+func (i *Requster) findMirror(url string) (*mirrorGroup, string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, group := range i.mirrors {
+		for _, mirror := range group.mirrors {
+			if strings.HasPrefix(url, mirror) {
+				return group, mirror
+			}
+		}
+	}
+	return nil, ""
+}
+
+// currentMirror returns the mirror that last worked, loading it from the
+// cache the first time, or the primary if none is known.
+func (i *Requster) currentMirror(ctx context.Context, group *mirrorGroup) string {
+	i.mu.Lock()
+	loaded := group.loaded
+	i.mu.Unlock()
+
+	if !loaded {
+		i.loadMirrors(ctx, group)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if group.current == "" {
+		return group.mirrors[0]
+	}
+	return group.current
+}
+
+// loadMirrors loads the domain moves and the mirror that last worked from
+// the cache.
+func (i *Requster) loadMirrors(ctx context.Context, group *mirrorGroup) {
+	moves, movesErr := i.c.Get(ctx, movesKey(group))
+	cached, err := i.c.Get(ctx, mirrorKey(group))
+
+	i.mu.Lock()
+	if group.loaded {
+		i.mu.Unlock()
+		return
+	}
+	group.loaded = true
+
+	if movesErr == nil {
+		for _, mirror := range strings.Fields(string(moves)) {
+			if !slices.Contains(group.mirrors, mirror) {
+				group.mirrors = append(group.mirrors, mirror)
+				group.moved = append(group.moved, mirror)
+				group.restored = append(group.restored, mirror)
+			}
+		}
+	}
+	if err == nil && slices.Contains(group.mirrors, string(cached)) {
+		group.current = string(cached)
+	}
+	i.mu.Unlock()
+}
+
+// markMirrorHealthy remembers the mirror of the URL as the one to try first.
+func (i *Requster) markMirrorHealthy(ctx context.Context, url string) {
+	group, mirror := i.findMirror(url)
+	if group == nil {
+		return
+	}
+
+	i.mu.Lock()
+	previous := group.current
+	if previous == "" {
+		previous = group.mirrors[0]
+	}
+	changed := previous != mirror
+	group.current = mirror
+	group.loaded = true
+	restored := slices.Contains(group.restored, mirror)
+	if restored {
+		group.restored = slices.DeleteFunc(group.restored, func(m string) bool { return m == mirror })
+	}
+	primary, onMove := group.mirrors[0], i.onMove
+	i.mu.Unlock()
+
+	if restored && onMove != nil {
+		onMove(DomainMove{Primary: primary, From: primary, To: mirror, Restored: true})
+	}
+	if !changed {
+		return
+	}
+	logging.Info().Str("primary", group.mirrors[0]).Str("mirror", mirror).Msg("Switched to healthy mirror")
+	err := i.c.SetWithExpiration(ctx, mirrorKey(group), []byte(mirror), mirrorCacheExpiration)
+	if err != nil {
+		logging.Error().Err(err).Str("mirror", mirror).Msg("Failed to save healthy mirror to cache")
+	}
+}
+
+// rewriteMirror rewrites a URL of the same group as target to the mirror of target.
+func (i *Requster) rewriteMirror(url, target string) string {
+	group, mirror := i.findMirror(url)
+	targetGroup, targetMirror := i.findMirror(target)
+	if group == nil || group != targetGroup {
+		return url
+	}
+	return targetMirror + strings.TrimPrefix(url, mirror)
+}
+
+func mirrorKey(group *mirrorGroup) string {
+	return fmt.Sprintf("%s:%s", mirrorCacheKey, group.mirrors[0])
+}
+
+// isMirrorError reports whether the error means the mirror is unusable and
+// the next one should be tried.
+func isMirrorError(err error) bool {
+	if errors.Is(err, ErrServerError) || errors.Is(err, ErrChallenge) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError reports whether the error is a DNS or TLS failure, which
+// FlareSolverr cannot work around either.
+func isConnectionError(err error) bool {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var headerErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &dnsErr) ||
+		errors.As(err, &certErr) ||
+		errors.As(err, &headerErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
@@ -0,0 +1,200 @@
+package requester
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+const movesCacheKey = "domainMoves"
+
+// metaRefreshRegex matches the URL of a <meta http-equiv="refresh"> tag,
+// often left in the old domain of a site that moved.
+var metaRefreshRegex = regexp.MustCompile(`(?i)<meta[^>]+http-equiv=["']?refresh["']?[^>]+content=["']?\s*\d+\s*;\s*url=['"]?([^"'>\s]+)`)
+
+// movedBannerRegex matches the first URL after a "we moved to" banner, in
+// English or Portuguese, left in the old domain of a site that moved. The URL
+// may be any link near the text, so the move is only followed once verified.
+var movedBannerRegex = regexp.MustCompile(`(?is)(?:we(?:'ve| have)? moved to|mudamos para|nosso novo (?:endere[çc]o|dom[íi]nio)|novo (?:endere[çc]o|dom[íi]nio) (?:é|e)).{0,300}?(https?://[^"'<>\s]+)`)
+
+// DomainMove is a site that moved to a new domain.
+type DomainMove struct {
+	Primary  string // the primary base URL of the site, as registered with AddMirrors
+	From     string // the base URL the site moved from
+	To       string // the base URL the site moved to
+	Restored bool   // whether the move was loaded from the cache instead of detected now
+}
+
+// SetDomainMoveHandler sets the function called when a site moves to a new
+// domain, or when a move detected before is loaded from the cache and the
+// new domain serves a page again.
+func (i *Requster) SetDomainMoveHandler(fn func(DomainMove)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.onMove = fn
+}
+
+// SetDomainMoveVerifier sets the function that checks a move found in a
+// "we moved to" banner before it is followed, e.g. by fetching the new
+// domain and looking for posts. Without it, the banners are only logged.
+func (i *Requster) SetDomainMoveVerifier(fn func(context.Context, DomainMove) bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.verifyMove = fn
+}
+
+// recordDomainMove makes the new domain of the site the mirror to try first,
+// persisting it in the cache. from is the URL requested and to the URL the
+// site moved to.
+func (i *Requster) recordDomainMove(ctx context.Context, from, to string) {
+	group, mirror := i.findMirror(from)
+	if group == nil {
+		return
+	}
+	base, err := neturl.Parse(mirror)
+	if err != nil {
+		return
+	}
+	target, err := neturl.Parse(to)
+	if err != nil || target.Host == "" {
+		return
+	}
+	moved := fmt.Sprintf("%s://%s%s", target.Scheme, target.Host, base.Path)
+
+	// only the base URL, or pages keeping their path in the new domain, tell
+	// the site moved; a post may redirect anywhere
+	if path := strings.TrimPrefix(from, mirror); path != "" && strings.TrimPrefix(to, moved) != path {
+		return
+	}
+
+	i.mu.Lock()
+	if !slices.Contains(group.mirrors, moved) {
+		group.mirrors = append(group.mirrors, moved)
+		group.moved = append(group.moved, moved)
+	}
+	group.current = moved
+	primary, moves, onMove := group.mirrors[0], strings.Join(group.moved, "\n"), i.onMove
+	i.mu.Unlock()
+
+	logging.Warn().Str("primary", primary).Str("from", mirror).Str("to", moved).Msg("Site moved to a new domain")
+
+	if err := i.c.SetWithExpiration(ctx, movesKey(group), []byte(moves), mirrorCacheExpiration); err != nil {
+		logging.Error().Err(err).Str("mirror", moved).Msg("Failed to save domain move to cache")
+	}
+	if err := i.c.SetWithExpiration(ctx, mirrorKey(group), []byte(moved), mirrorCacheExpiration); err != nil {
+		logging.Error().Err(err).Str("mirror", moved).Msg("Failed to save healthy mirror to cache")
+	}
+
+	if onMove != nil {
+		onMove(DomainMove{Primary: primary, From: mirror, To: moved})
+	}
+}
+
+// checkMovedBanner follows the move announced by a "we moved to" banner in
+// the home page of a site, if the verifier confirms the new domain serves it.
+// from is the URL requested and body its content.
+func (i *Requster) checkMovedBanner(ctx context.Context, from string, body []byte) {
+	group, mirror := i.findMirror(from)
+	if group == nil || from != mirror {
+		return
+	}
+	to := bannerLocation(from, body)
+	if to == "" {
+		return
+	}
+
+	i.mu.Lock()
+	rejected, verify := group.rejected == to, i.verifyMove
+	primary := group.mirrors[0]
+	i.mu.Unlock()
+	if rejected {
+		return
+	}
+
+	move := DomainMove{Primary: primary, From: mirror, To: to}
+	if verify == nil || !verify(ctx, move) {
+		logging.Info().Str("primary", primary).Str("from", mirror).Str("to", to).Msg("Ignoring moved banner that could not be verified")
+		i.mu.Lock()
+		group.rejected = to
+		i.mu.Unlock()
+		return
+	}
+	i.recordDomainMove(ctx, from, to)
+}
+
+func movesKey(group *mirrorGroup) string {
+	return fmt.Sprintf("%s:%s", movesCacheKey, group.mirrors[0])
+}
+
+// movedLocation returns the URL the site moved to, given the location of the
+// last permanent redirect followed and the body of the response, with a meta
+// refresh, or an empty string if it did not move to another host.
+func movedLocation(url, location string, body []byte) string {
+	if location == "" {
+		match := metaRefreshRegex.FindSubmatch(body)
+		if match == nil {
+			return ""
+		}
+		location = string(match[1])
+	}
+	return otherHost(url, location)
+}
+
+// bannerLocation returns the URL announced by a "we moved to" banner in the
+// body, or an empty string if there is none pointing to another host.
+func bannerLocation(url string, body []byte) string {
+	match := movedBannerRegex.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return otherHost(url, string(match[1]))
+}
+
+// otherHost resolves the location against url, returning it only if it is in another host.
+func otherHost(url, location string) string {
+	from, err := neturl.Parse(url)
+	if err != nil {
+		return ""
+	}
+	to, err := from.Parse(location)
+	if err != nil || to.Host == "" || strings.EqualFold(to.Host, from.Host) {
+		return ""
+	}
+	return to.String()
+}
+
+type redirectKey struct{}
+
+// redirectRecord holds the location of the last permanent redirect followed by a request.
+type redirectRecord struct {
+	location string
+}
+
+func withRedirectRecord(ctx context.Context, record *redirectRecord) context.Context {
+	return context.WithValue(ctx, redirectKey{}, record)
+}
+
+// recordPermanentRedirect is the CheckRedirect of the client. It follows the
+// redirects like the default one, recording the permanent ones in the request
+// context. Temporary redirects are left out, since challenges, logins and ads use them.
+func recordPermanentRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.Response == nil {
+		return nil
+	}
+	switch req.Response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		if record, ok := req.Context().Value(redirectKey{}).(*redirectRecord); ok {
+			record.location = req.URL.String()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package requester_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// movingTransport serves the home page of old.example with oldHome, or
+// redirects it with status to new.example, which answers every request.
+type movingTransport struct {
+	status  int
+	oldHome string
+}
+
+func (t movingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("<html><body>new " + req.URL.Path + "</body></html>")),
+		Request:    req,
+	}
+	if req.URL.Host == "old.example" {
+		if t.status != 0 {
+			resp.StatusCode = t.status
+			resp.Header.Set("Location", "https://new.example"+req.URL.Path)
+			resp.Body = io.NopCloser(strings.NewReader(""))
+		} else {
+			resp.Body = io.NopCloser(strings.NewReader(t.oldHome))
+		}
+	}
+	return resp, nil
+}
+
+func Test_DomainMoves(t *testing.T) {
+	banner := `<html><body><div class="aviso">We moved to <a href="https://new.example/">new.example</a>!</div></body></html>`
+	tests := []struct {
+		name      string
+		transport movingTransport
+		verified  bool
+		wantMove  bool
+	}{
+		{name: "301", transport: movingTransport{status: http.StatusMovedPermanently}, wantMove: true},
+		{name: "308", transport: movingTransport{status: http.StatusPermanentRedirect}, wantMove: true},
+		{name: "302", transport: movingTransport{status: http.StatusFound}},
+		{name: "307", transport: movingTransport{status: http.StatusTemporaryRedirect}},
+		{name: "meta refresh", transport: movingTransport{oldHome: `<html><head><meta http-equiv="refresh" content="0; url=https://new.example/"></head></html>`}, wantMove: true},
+		{name: "verified banner", transport: movingTransport{oldHome: banner}, verified: true, wantMove: true},
+		{name: "verified portuguese banner", transport: movingTransport{oldHome: `<html><body><p>Mudamos para um novo domínio: <b>https://new.example/</b></p></body></html>`}, verified: true, wantMove: true},
+		{name: "unverified banner", transport: movingTransport{oldHome: banner}},
+		{name: "link without banner", transport: movingTransport{oldHome: `<html><body><a href="https://new.example/">parceiro</a></body></html>`}, verified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+			req.SetTransport(tt.transport)
+			req.AddMirrors("https://old.example/")
+			var moves []requester.DomainMove
+			req.SetDomainMoveHandler(func(move requester.DomainMove) {
+				moves = append(moves, move)
+			})
+			req.SetDomainMoveVerifier(func(_ context.Context, move requester.DomainMove) bool {
+				if move.To != "https://new.example/" {
+					t.Errorf("verified move to %q, want https://new.example/", move.To)
+				}
+				return tt.verified
+			})
+
+			if _, err := req.GetDocument(context.Background(), "https://old.example/"); err != nil {
+				t.Fatalf("GetDocument() error = %v", err)
+			}
+			if got := len(moves) == 1; got != tt.wantMove {
+				t.Fatalf("moves = %v, want a move: %v", moves, tt.wantMove)
+			}
+			want := "https://old.example/page"
+			if tt.wantMove {
+				want = "https://new.example/page"
+				if moves[0].To != "https://new.example/" {
+					t.Errorf("move to %q, want https://new.example/", moves[0].To)
+				}
+			}
+			if got := req.ResolveMirror(context.Background(), "https://old.example/page"); got != want {
+				t.Errorf("ResolveMirror() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func Test_RestoredDomainMoves(t *testing.T) {
+	c := cache.NewMemory()
+	first := requester.NewRequester(requester.NewFlareSolverr("", 1000), c, time.Second)
+	first.SetTransport(movingTransport{status: http.StatusMovedPermanently})
+	first.AddMirrors("https://old.example/")
+	if _, err := first.GetDocument(context.Background(), "https://old.example/"); err != nil {
+		t.Fatalf("GetDocument() error = %v", err)
+	}
+
+	// a restart loads the move from the cache, but only reports it once the
+	// new domain serves a page
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), c, time.Second)
+	req.SetTransport(movingTransport{status: http.StatusMovedPermanently})
+	req.AddMirrors("https://old.example/")
+	var moves []requester.DomainMove
+	req.SetDomainMoveHandler(func(move requester.DomainMove) {
+		moves = append(moves, move)
+	})
+	if got := req.ResolveMirror(context.Background(), "https://old.example/page"); got != "https://new.example/page" {
+		t.Fatalf("ResolveMirror() = %q, want https://new.example/page", got)
+	}
+	if len(moves) != 0 {
+		t.Fatalf("moves before a page is served = %v, want none", moves)
+	}
+	if _, err := req.GetDocument(context.Background(), "https://old.example/page"); err != nil {
+		t.Fatalf("GetDocument() error = %v", err)
+	}
+	if len(moves) != 1 || !moves[0].Restored || moves[0].To != "https://new.example/" {
+		t.Errorf("moves = %v, want the restored move to https://new.example/", moves)
+	}
+}
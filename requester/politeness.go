@@ -0,0 +1,164 @@
+package requester
+
+import (
+	"context"
+	"math"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit caps the requests sent to a host. The zero value does not limit anything.
+type HostLimit struct {
+	Rate           float64 // requests per second, 0 for no rate limit
+	Burst          int     // requests that can be sent at once before Rate applies, at least 1
+	MaxConcurrency int     // requests in flight at the same time, 0 for no limit
+}
+
+// hostLimiter is a token bucket and a semaphore for a single host.
+type hostLimiter struct {
+	limit HostLimit
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(limit HostLimit) *hostLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	l := &hostLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+	if limit.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrency)
+	}
+	return l
+}
+
+// acquire blocks until a request can be sent, returning the function that
+// releases its concurrency slot.
+func (l *hostLimiter) acquire(ctx context.Context) (func(), error) {
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	delay := l.reserve()
+	if delay <= 0 {
+		return release, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		l.cancel()
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket, returning how long to wait for it.
+func (l *hostLimiter) reserve() time.Duration {
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.limit.Rate * float64(time.Second))
+}
+
+// cancel gives back a token reserved by a request that was not sent.
+func (l *hostLimiter) cancel() {
+	if l.limit.Rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// SetDefaultHostLimit sets the limit of the hosts without one of their own.
+// It must be called before the first request.
+func (i *Requster) SetDefaultHostLimit(limit HostLimit) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.defaultLimit = limit
+}
+
+// SetHostLimit sets the limit of the hosts of the given URLs, usually the
+// base URL and mirrors of an indexer. Each host is limited on its own.
+// It must be called before the first request.
+func (i *Requster) SetHostLimit(limit HostLimit, urls ...string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.hostLimits == nil {
+		i.hostLimits = make(map[string]HostLimit)
+	}
+	for _, u := range urls {
+		if host := hostOf(u); host != "" {
+			i.hostLimits[host] = limit
+		}
+	}
+}
+
+// SetQueueWaitHandler sets the function called with the time each request
+// waited for the limit of its host.
+func (i *Requster) SetQueueWaitHandler(fn func(host string, wait time.Duration)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.onQueueWait = fn
+}
+
+// waitForHost blocks until a request to the URL is allowed by the limit of
+// its host, returning the function to call when the request is done.
+func (i *Requster) waitForHost(ctx context.Context, url string) (func(), error) {
+	host := hostOf(url)
+	i.mu.Lock()
+	if i.limiters == nil {
+		i.limiters = make(map[string]*hostLimiter)
+	}
+	limiter, ok := i.limiters[host]
+	if !ok {
+		limit, ok := i.hostLimits[host]
+		if !ok {
+			limit = i.defaultLimit
+		}
+		limiter = newHostLimiter(limit)
+		i.limiters[host] = limiter
+	}
+	onQueueWait := i.onQueueWait
+	i.mu.Unlock()
+
+	start := time.Now()
+	release, err := limiter.acquire(ctx)
+	if onQueueWait != nil {
+		onQueueWait(host, time.Since(start))
+	}
+	return release, err
+}
+
+// hostOf returns the lowercase host of the URL, or an empty string if it is invalid.
+func hostOf(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,96 @@
+package requester_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// slowTransport answers every request after a delay, tracking how many are in flight.
+type slowTransport struct {
+	delay    time.Duration
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func (t *slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+	for {
+		seen := t.maxSeen.Load()
+		if n <= seen || t.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("ok")),
+		Request:    req,
+	}, nil
+}
+
+func doConcurrently(t *testing.T, req *requester.Requster, url string, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest(http.MethodGet, url, nil)
+			if _, err := req.Do(r); err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_HostLimitConcurrency(t *testing.T) {
+	transport := &slowTransport{delay: 20 * time.Millisecond}
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(transport)
+	req.SetHostLimit(requester.HostLimit{MaxConcurrency: 2}, "https://example.com/")
+
+	var waits atomic.Int32
+	req.SetQueueWaitHandler(func(host string, wait time.Duration) {
+		if host == "example.com" {
+			waits.Add(1)
+		}
+	})
+
+	doConcurrently(t, req, "https://example.com/post/", 8)
+	if got := transport.maxSeen.Load(); got != 2 {
+		t.Errorf("max concurrent requests = %d, want 2", got)
+	}
+	if got := waits.Load(); got != 8 {
+		t.Errorf("queue wait observed %d times, want 8", got)
+	}
+
+	// other hosts use the default limit, which does not limit anything
+	transport.maxSeen.Store(0)
+	doConcurrently(t, req, "https://other.example/post/", 4)
+	if got := transport.maxSeen.Load(); got <= 2 {
+		t.Errorf("max concurrent requests to an unlimited host = %d, want more than 2", got)
+	}
+}
+
+func Test_HostLimitRate(t *testing.T) {
+	req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+	req.SetTransport(&slowTransport{})
+	req.SetDefaultHostLimit(requester.HostLimit{Rate: 20, Burst: 1})
+
+	start := time.Now()
+	doConcurrently(t, req, "https://example.com/post/", 4)
+	// the first request is sent at once and the other three every 50ms
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("4 requests at 20/s took %v, want at least 150ms", elapsed)
+	}
+}
@@ -3,14 +3,17 @@ package requester
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/felipemarinho97/torrent-indexer/cache"
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/proxy"
 	"github.com/felipemarinho97/torrent-indexer/utils"
 	"github.com/fereidani/httpdecompressor"
 )
@@ -21,27 +24,80 @@ const (
 
 var challangeRegex = regexp.MustCompile(`(?i)(just a moment|cf-chl-bypass|under attack)`)
 
+var (
+	// ErrChallenge is returned when the site answers with an anti-bot challenge that could not be solved.
+	ErrChallenge = errors.New("response is a challenge")
+	// ErrInvalidResponse is returned when the site answers with an empty or non-HTML body.
+	ErrInvalidResponse = errors.New("response is not valid HTML")
+)
+
 type Requster struct {
 	fs                        *FlareSolverr
 	c                         *cache.Redis
 	httpClient                *http.Client
 	shortLivedCacheExpiration time.Duration
+
+	mu         sync.Mutex
+	mirrors    []*mirrorGroup
+	onMove     func(DomainMove)
+	verifyMove func(context.Context, DomainMove) bool
+	archive    *Archive
+
+	defaultLimit HostLimit
+	hostLimits   map[string]HostLimit
+	limiters     map[string]*hostLimiter
+	onQueueWait  func(host string, wait time.Duration)
+
+	breakerConfig  BreakerConfig
+	breakers       map[string]*circuitBreaker
+	onCircuitState func(upstream string, state CircuitState)
+
+	retryConfig RetryConfig
 }
 
 func NewRequester(fs *FlareSolverr, c *cache.Redis, timeout time.Duration) *Requster {
 	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
+		Timeout:       timeout,
+		CheckRedirect: recordPermanentRedirect,
+		// the requests go through the proxy pool of the indexer, if any
+		Transport: proxy.NewTransport(&http.Transport{
 			DisableCompression:  false,
 			MaxIdleConns:        100,              // Increase connection pool
 			MaxIdleConnsPerHost: 10,               // More connections per host
 			IdleConnTimeout:     90 * time.Second, // Keep connections alive longer
 			DisableKeepAlives:   false,            // Enable keep-alive
 			ForceAttemptHTTP2:   true,             // Use HTTP/2 when possible
-		},
+		}),
 	}
 
-	return &Requster{fs: fs, httpClient: httpClient, c: c, shortLivedCacheExpiration: 30 * time.Minute}
+	i := &Requster{
+		fs:                        fs,
+		httpClient:                httpClient,
+		c:                         c,
+		shortLivedCacheExpiration: 30 * time.Minute,
+		breakerConfig:             DefaultBreakerConfig,
+		retryConfig:               DefaultRetryConfig,
+	}
+	fs.SetClearanceHandler(i.saveClearance)
+	return i
+}
+
+// SetArchive records the fetched bodies to the archive, or serves the
+// requests exclusively from it, depending on its mode.
+func (i *Requster) SetArchive(archive *Archive) {
+	i.archive = archive
+}
+
+// BypassesCache reports whether the document caches must be skipped, so
+// every page goes through the archive to be recorded or replayed.
+func (i *Requster) BypassesCache() bool {
+	return i.archive.Recording() || i.archive.Replaying()
+}
+
+// SetTransport replaces the transport of the plain HTTP client, e.g. to serve
+// the requests from saved pages in tests.
+func (i *Requster) SetTransport(transport http.RoundTripper) {
+	i.httpClient.Transport = transport
 }
 
 func (i *Requster) SetShortLivedCacheExpiration(expiration time.Duration) {
@@ -49,38 +105,199 @@ func (i *Requster) SetShortLivedCacheExpiration(expiration time.Duration) {
 }
 
 func (i *Requster) GetDocument(ctx context.Context, url string, referer ...string) (io.ReadCloser, error) {
-	var body io.ReadCloser
-
 	// Extract referer if provided
 	ref := ""
 	if len(referer) > 0 {
 		ref = referer[0]
 	}
 
+	if i.archive.Replaying() {
+		bodyByte, err := i.archive.Load(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		logging.Debug().Str("url", url).Msg("Returning from archive")
+		return io.NopCloser(bytes.NewReader(bodyByte)), nil
+	}
+
 	// try request from short-lived cache
 	key := fmt.Sprintf("%s:%s", cacheKey, url)
-	bodyByte, err := i.c.Get(ctx, key)
-	if err == nil {
-		logging.Debug().Str("url", url).Msg("Returning from short-lived cache")
-		body = io.NopCloser(bytes.NewReader(bodyByte))
-		return body, nil
+	var bodyByte []byte
+	var err error
+	if !i.BypassesCache() {
+		bodyByte, err = i.c.Get(ctx, key)
+		if err == nil {
+			logging.Debug().Str("url", url).Msg("Returning from short-lived cache")
+			return io.NopCloser(bytes.NewReader(bodyByte)), nil
+		}
+	}
+
+	// try each mirror of the site, starting with the one that last worked
+	for _, candidate := range i.mirrorCandidates(ctx, url) {
+		var movedTo string
+		bodyByte, movedTo, err = i.fetch(ctx, candidate, i.rewriteMirror(ref, candidate))
+		if err == nil {
+			i.markMirrorHealthy(ctx, candidate)
+			if movedTo != "" {
+				i.recordDomainMove(ctx, candidate, movedTo)
+			} else {
+				i.checkMovedBanner(ctx, candidate, bodyByte)
+			}
+			break
+		}
+		if !isMirrorError(err) {
+			return nil, err
+		}
+		logging.Warn().Err(err).Str("url", candidate).Msg("Mirror failed, trying the next one")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if i.archive.Recording() {
+		if err := i.archive.Save(http.MethodGet, url, nil, bodyByte); err != nil {
+			logging.Error().Err(err).Str("url", url).Msg("Failed to save response to archive")
+		}
+		return io.NopCloser(bytes.NewReader(bodyByte)), nil
+	}
+
+	// save response to cache, it is not a challange, not empty and is valid HTML
+	err = i.c.SetWithExpiration(ctx, key, bodyByte, i.shortLivedCacheExpiration)
+	if err != nil {
+		logging.Error().Err(err).Str("url", url).Msg("Failed to save response to cache")
+	}
+	logging.Debug().Str("url", url).Msg("Saved to cache")
+
+	return io.NopCloser(bytes.NewReader(bodyByte)), nil
+}
+
+// Do sends a request other than a page fetch, e.g. a POST search, and returns
+// the response body. Like GetDocument, it is recorded to or replayed from the archive.
+func (i *Requster) Do(req *http.Request) ([]byte, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+	}
+	url := req.URL.String()
+
+	if i.archive.Replaying() {
+		return i.archive.Load(req.Method, url, reqBody)
 	}
 
+	breaker := i.breakerFor(url)
+	if err := breaker.allow(); err != nil {
+		return nil, fmt.Errorf("%w for url %s", err, url)
+	}
+	release, err := i.waitForHost(req.Context(), url)
+	if err != nil {
+		breaker.record(err)
+		return nil, fmt.Errorf("failed to do request for url %s: %w", url, err)
+	}
+	defer release()
+
+	resp, err := i.httpClient.Do(req)
+	breaker.record(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to do request for url %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if i.archive.Recording() {
+		if err := i.archive.Save(req.Method, url, reqBody, body); err != nil {
+			logging.Error().Err(err).Str("url", url).Msg("Failed to save response to archive")
+		}
+	}
+	return body, nil
+}
+
+// fetch fetches the URL through the circuit breaker of its host, failing at
+// once if the host is failing. Retryable errors are retried with exponential
+// backoff; the errors returned are *FetchError.
+func (i *Requster) fetch(ctx context.Context, url, ref string) ([]byte, string, error) {
+	breaker := i.breakerFor(url)
+	if err := breaker.allow(); err != nil {
+		return nil, "", fmt.Errorf("%w for url %s", err, url)
+	}
+	// the retries are part of the same fetch, only its outcome is recorded
+	body, movedTo, err := i.fetchWithRetries(ctx, url, ref)
+	breaker.record(err)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, movedTo, nil
+}
+
+// fetchWithRetries fetches the URL, sending it again after the retryable errors.
+func (i *Requster) fetchWithRetries(ctx context.Context, url, ref string) ([]byte, string, error) {
+	for attempt := 0; ; attempt++ {
+		body, movedTo, err := i.fetchPage(ctx, url, ref)
+		if err == nil {
+			return body, movedTo, nil
+		}
+
+		fe := newFetchError(url, err)
+		delay, ok := i.retryDelay(fe, attempt)
+		if !ok || !sleepRetry(ctx, url, fe, delay) {
+			return nil, "", fe
+		}
+	}
+}
+
+// fetchPage requests the URL with the plain client, falling back to FlareSolverr
+// on challenges, and returns the body if it is valid HTML. If the site says it
+// moved, through a permanent redirect or a meta refresh, the new URL is
+// returned too.
+func (i *Requster) fetchPage(ctx context.Context, url, ref string) ([]byte, string, error) {
+	var body io.ReadCloser
+
+	// the slot is released before falling back to FlareSolverr, which is
+	// limited by its session pool, so a slow solve does not block the host
+	acquired, err := i.waitForHost(ctx, url)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to do request for url %s: %w", url, err)
+	}
+	release := sync.OnceFunc(acquired)
+	defer release()
+
 	// try request with plain client
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	redirect := &redirectRecord{}
+	req, err := http.NewRequestWithContext(withRedirectRecord(ctx, redirect), "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request for url %s: %w", url, err)
+		return nil, "", fmt.Errorf("failed to create request for url %s: %w", url, err)
 	}
 
 	// Add browser-like headers to spoof a real browser
 	spoofBrowserHeaders(req, ref)
+	// replay the challenge solved before by FlareSolverr, if it did not expire
+	cleared := i.applyClearance(ctx, req)
 
-	resp, err := i.httpClient.Do(req)
-	if err != nil {
+	resp, plainErr := i.httpClient.Do(req)
+	if plainErr != nil {
+		plainErr = fmt.Errorf("failed to do request for url %s: %w", url, plainErr)
+		switch classifyError(plainErr) {
+		case ClassDNS, ClassTLS, ClassConnectionRefused:
+			// FlareSolverr can not work around these either
+			return nil, "", plainErr
+		}
 		// try request with flare solverr
+		release()
 		body, err = i.fs.Get(ctx, url, 3)
 		if err != nil {
-			return nil, fmt.Errorf("failed to do request for url %s: %w", url, err)
+			return nil, "", fmt.Errorf("failed to do request for url %s: %w", url, err)
 		}
 	} else {
 		defer resp.Body.Close()
@@ -88,7 +305,7 @@ func (i *Requster) GetDocument(ctx context.Context, url string, referer ...strin
 		// Decompress response using httpdecompressor
 		body, err = httpdecompressor.Reader(resp)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decompress response: %w", err)
+			return nil, "", fmt.Errorf("failed to decompress response: %w", err)
 		}
 		defer body.Close()
 	}
@@ -104,36 +321,41 @@ func (i *Requster) GetDocument(ctx context.Context, url string, referer ...strin
 	// Use io.Copy instead of io.ReadAll for better performance
 	_, err = io.Copy(&buf, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	bodyByte := buf.Bytes()
+	if plainErr != nil && len(bodyByte) == 0 {
+		// FlareSolverr is not configured, the plain client error is what went wrong
+		return nil, "", plainErr
 	}
-	bodyByte = buf.Bytes()
 	if hasChallange(bodyByte) {
+		if cleared {
+			i.expireClearance(ctx, url)
+		}
 		// try request with flare solverr
+		release()
 		body, err = i.fs.Get(ctx, url, 3)
 		if err != nil {
-			return nil, fmt.Errorf("failed to do request for url %s: %w", url, err)
+			return nil, "", fmt.Errorf("failed to do request for url %s: %w", url, err)
 		}
 		bodyByte, err = io.ReadAll(body)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+			return nil, "", fmt.Errorf("failed to read response body: %w", err)
 		}
 		logging.Debug().Str("url", url).Msg("Request served from flaresolverr")
+	} else if resp != nil && statusError(url, resp) != nil {
+		return nil, "", statusError(url, resp)
 	} else {
-		logging.Debug().Str("url", url).Msg("Request served from plain client")
+		logging.Debug().Str("url", url).Bool("clearance", cleared).Msg("Request served from plain client")
 	}
 
-	// save response to cache if it's not a challange, body is not empty and is valid HTML
-	if !hasChallange(bodyByte) && len(bodyByte) > 0 && utils.IsValidHTML(string(bodyByte)) {
-		err = i.c.SetWithExpiration(ctx, key, bodyByte, i.shortLivedCacheExpiration)
-		if err != nil {
-			logging.Error().Err(err).Str("url", url).Msg("Failed to save response to cache")
-		}
-		logging.Debug().Str("url", url).Msg("Saved to cache")
-	} else {
-		return nil, fmt.Errorf("response is a challange")
+	if hasChallange(bodyByte) {
+		return nil, "", fmt.Errorf("%w for url %s", ErrChallenge, url)
 	}
-
-	return io.NopCloser(bytes.NewReader(bodyByte)), nil
+	if len(bodyByte) == 0 || !utils.IsValidHTML(string(bodyByte)) {
+		return nil, "", fmt.Errorf("%w for url %s", ErrInvalidResponse, url)
+	}
+	return bodyByte, movedLocation(url, redirect.location, bodyByte), nil
 }
 
 func (i *Requster) ExpireDocument(ctx context.Context, url string) error {
@@ -0,0 +1,207 @@
+package requester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+)
+
+// ErrorClass classifies why a page could not be fetched.
+type ErrorClass string
+
+const (
+	ClassDNS               ErrorClass = "dns"                // the host name could not be resolved
+	ClassTLS               ErrorClass = "tls"                // the TLS handshake or certificate failed
+	ClassConnectionRefused ErrorClass = "connection_refused" // nothing is listening on the host
+	ClassTimeout           ErrorClass = "timeout"            // the site took too long to answer
+	ClassForbidden         ErrorClass = "forbidden"          // the site answered 403 without a challenge
+	ClassRateLimited       ErrorClass = "rate_limited"       // the site answered 429
+	ClassUnavailable       ErrorClass = "unavailable"        // the site answered 503 without a challenge
+	ClassServerError       ErrorClass = "server_error"       // the site answered another 5xx status
+	ClassChallenge         ErrorClass = "challenge"          // the anti-bot challenge could not be solved
+	ClassTruncated         ErrorClass = "truncated"          // the connection was closed before the whole body was read
+	ClassInvalidResponse   ErrorClass = "invalid_response"   // the body is empty or not HTML
+	ClassFlareSolverr      ErrorClass = "flaresolverr"       // FlareSolverr could not be reached
+	ClassUnknown           ErrorClass = "unknown"
+)
+
+// FetchError is the error returned when a page could not be fetched.
+// It wraps the cause, so errors.Is still matches ErrChallenge, ErrServerError,
+// ErrInvalidResponse and the network errors.
+type FetchError struct {
+	URL        string
+	Class      ErrorClass
+	StatusCode int           // the status the site answered with, 0 if it did not answer
+	RetryAfter time.Duration // the Retry-After of a 429 or 503, 0 if not sent
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request may succeed if sent again later.
+func (e *FetchError) Retryable() bool {
+	switch e.Class {
+	case ClassTimeout, ClassConnectionRefused, ClassRateLimited, ClassUnavailable, ClassServerError, ClassTruncated:
+		return true
+	default:
+		return false
+	}
+}
+
+// newFetchError classifies the error of a request to the URL.
+func newFetchError(url string, err error) *FetchError {
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe
+	}
+	return &FetchError{URL: url, Class: classifyError(err), Err: err}
+}
+
+// classifyError returns the class of an error that is not a status error.
+func classifyError(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return ClassDNS
+	case errors.Is(err, ErrFlareSolverrUnavailable):
+		return ClassFlareSolverr
+	case isConnectionError(err):
+		return ClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ClassConnectionRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ClassTruncated
+	case errors.Is(err, ErrChallenge):
+		return ClassChallenge
+	case errors.Is(err, ErrInvalidResponse):
+		return ClassInvalidResponse
+	default:
+		return ClassUnknown
+	}
+}
+
+// statusError returns the error of a response that is not a challenge, or nil
+// if its status is fine.
+func statusError(url string, resp *http.Response) error {
+	fe := &FetchError{URL: url, StatusCode: resp.StatusCode}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		fe.Class = ClassRateLimited
+		fe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		fe.Err = fmt.Errorf("rate limited (status %d) for url %s", resp.StatusCode, url)
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		fe.Class = ClassUnavailable
+		fe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		fe.Err = fmt.Errorf("%w (status %d) for url %s", ErrServerError, resp.StatusCode, url)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		fe.Class = ClassServerError
+		fe.Err = fmt.Errorf("%w (status %d) for url %s", ErrServerError, resp.StatusCode, url)
+	case resp.StatusCode == http.StatusForbidden:
+		fe.Class = ClassForbidden
+		fe.Err = fmt.Errorf("forbidden (status %d) for url %s", resp.StatusCode, url)
+	default:
+		return nil
+	}
+	return fe
+}
+
+// parseRetryAfter parses a Retry-After header, either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RetryConfig configures the retries of the pages that failed with a retryable error.
+type RetryConfig struct {
+	Retries   int           // retries after the first attempt, 0 disables them
+	BaseDelay time.Duration // delay before the first retry, doubled on each one
+	MaxDelay  time.Duration // maximum delay; a longer Retry-After gives up instead
+}
+
+// DefaultRetryConfig is used until another config is set.
+var DefaultRetryConfig = RetryConfig{Retries: 2, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// SetRetryConfig sets the retries of GetDocument.
+// Delays that are not positive are replaced by the default ones.
+func (i *Requster) SetRetryConfig(config RetryConfig) {
+	if config.BaseDelay <= 0 {
+		logging.Warn().Dur("base_delay", config.BaseDelay).Msg("Invalid retry base delay, using the default")
+		config.BaseDelay = DefaultRetryConfig.BaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		logging.Warn().Dur("max_delay", config.MaxDelay).Msg("Invalid retry max delay, using the default")
+		config.MaxDelay = DefaultRetryConfig.MaxDelay
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.retryConfig = config
+}
+
+// retryDelay returns how long to wait before retrying a request that failed
+// with the error, or false if it must not be retried.
+// attempt is the number of retries already done.
+func (i *Requster) retryDelay(err error, attempt int) (time.Duration, bool) {
+	i.mu.Lock()
+	config := i.retryConfig
+	i.mu.Unlock()
+
+	var fe *FetchError
+	if attempt >= config.Retries || !errors.As(err, &fe) || !fe.Retryable() {
+		return 0, false
+	}
+
+	// exponential backoff with jitter, so concurrent retries do not line up
+	// the shift is capped, since a large attempt would overflow the duration
+	backoff := config.MaxDelay
+	if attempt < 32 && config.BaseDelay <= config.MaxDelay>>attempt {
+		backoff = config.BaseDelay << attempt
+	}
+	backoff = max(backoff, 0)
+	delay := backoff/2 + rand.N(backoff/2+1)
+
+	if fe.RetryAfter > config.MaxDelay {
+		return 0, false
+	}
+	return max(delay, fe.RetryAfter), true
+}
+
+// sleepRetry waits before a retry, returning false if the context is done first.
+func sleepRetry(ctx context.Context, url string, err error, delay time.Duration) bool {
+	logging.Warn().Err(err).Str("url", url).Dur("delay", delay).Msg("Request failed, retrying")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
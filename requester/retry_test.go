@@ -0,0 +1,100 @@
+package requester_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/requester"
+)
+
+// statusTransport answers with the statuses in order, then with the last one.
+type statusTransport struct {
+	statuses   []int
+	retryAfter string
+	calls      atomic.Int32
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := int(t.calls.Add(1)) - 1
+	status := t.statuses[min(n, len(t.statuses)-1)]
+	header := http.Header{}
+	if t.retryAfter != "" {
+		header.Set("Retry-After", t.retryAfter)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("<html><body>page</body></html>")),
+		Request:    req,
+	}, nil
+}
+
+func Test_GetDocumentRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		wantClass  requester.ErrorClass
+		wantCalls  int32
+	}{
+		{name: "should retry a 503", statuses: []int{503, 200}, wantCalls: 2},
+		{name: "should retry a 429 honouring Retry-After", statuses: []int{429, 429, 200}, retryAfter: "0", wantCalls: 3},
+		{name: "should give up after the retries", statuses: []int{502}, wantClass: requester.ClassServerError, wantCalls: 3},
+		{name: "should not retry a 403", statuses: []int{403, 200}, wantClass: requester.ClassForbidden, wantCalls: 1},
+		{name: "should not wait for a Retry-After longer than the max delay", statuses: []int{429, 200}, retryAfter: "3600", wantClass: requester.ClassRateLimited, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &statusTransport{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+			req.SetTransport(transport)
+			req.SetRetryConfig(requester.RetryConfig{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+			_, err := req.GetDocument(context.Background(), "https://example.com/")
+			if tt.wantClass == "" && err != nil {
+				t.Fatalf("GetDocument() error = %v", err)
+			}
+			if tt.wantClass != "" {
+				var fe *requester.FetchError
+				if !errors.As(err, &fe) || fe.Class != tt.wantClass {
+					t.Fatalf("GetDocument() error = %v, want class %s", err, tt.wantClass)
+				}
+			}
+			if got := transport.calls.Load(); got != tt.wantCalls {
+				t.Errorf("requests sent = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_GetDocumentRetryDelays(t *testing.T) {
+	tests := []struct {
+		name   string
+		config requester.RetryConfig
+	}{
+		{name: "should cap the backoff of many retries", config: requester.RetryConfig{Retries: 70, BaseDelay: time.Nanosecond, MaxDelay: time.Microsecond}},
+		{name: "should use the default delays when they are not positive", config: requester.RetryConfig{Retries: 1, BaseDelay: -time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &statusTransport{statuses: []int{503}}
+			req := requester.NewRequester(requester.NewFlareSolverr("", 1000), cache.NewMemory(), time.Second)
+			req.SetTransport(transport)
+			req.SetRetryConfig(tt.config)
+
+			if _, err := req.GetDocument(context.Background(), "https://example.com/"); err == nil {
+				t.Fatal("GetDocument() error = nil, want the 503")
+			}
+			if got, want := transport.calls.Load(), int32(tt.config.Retries+1); got != want {
+				t.Errorf("requests sent = %d, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+// adLinkResolver decodes the ad links that carry the magnet link reversed and
+// base64 encoded in the "id" query parameter, e.g. https://www.seuvideo.xyz/?id=...
+type adLinkResolver struct {
+	hosts []string
+}
+
+// NewAdLinkResolver returns a resolver of the ad links of the hosts.
+func NewAdLinkResolver(hosts ...string) LinkResolver {
+	return adLinkResolver{hosts: hosts}
+}
+
+func (adLinkResolver) Name() string {
+	return "adlink"
+}
+
+func (r adLinkResolver) Match(u *url.URL) bool {
+	return matchHost(u, r.hosts)
+}
+
+func (adLinkResolver) Resolve(_ context.Context, u *url.URL) ([]string, error) {
+	decoded, err := utils.DecodeAdLink(u.Query().Get("id"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ad link: %w", err)
+	}
+	if !strings.HasPrefix(decoded, "magnet:") {
+		// the same links are also used for the online players
+		if !strings.Contains(decoded, "watch.brplayer") {
+			logging.Warn().Str("href", u.String()).Str("decoded", decoded).Msg("Link decoding resulted in non-magnet link")
+		}
+		return nil, nil
+	}
+	return []string{decoded}, nil
+}
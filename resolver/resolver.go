@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+)
+
+// LinkResolver decodes the links of a link protector into magnet links.
+type LinkResolver interface {
+	// Name identifies the resolver in the metrics and logs, e.g. "soralink".
+	Name() string
+	// Match reports whether the resolver handles the link.
+	Match(u *url.URL) bool
+	// Resolve returns the magnet links the protected link points to.
+	Resolve(ctx context.Context, u *url.URL) ([]string, error)
+}
+
+var (
+	mu sync.RWMutex
+	// resolvers is the registry of link resolvers, in the order they are tried.
+	resolvers = []LinkResolver{
+		NewAdLinkResolver("seuvideo.xyz", "systemads.org"),
+		NewSoraLinkResolver("https://vacadb.org"),
+	}
+)
+
+// Register adds a link resolver to the registry.
+func Register(r LinkResolver) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range resolvers {
+		if existing.Name() == r.Name() {
+			return fmt.Errorf("link resolver already registered: %s", r.Name())
+		}
+	}
+	resolvers = append(resolvers, r)
+	return nil
+}
+
+// Lookup returns the first registered resolver that handles the link.
+func Lookup(u *url.URL) (LinkResolver, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, r := range resolvers {
+		if r.Match(u) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Resolver turns the links of a post into magnet links, decoding the
+// protected ones with the registered resolvers. The decoded links are cached.
+type Resolver struct {
+	cache   *cache.Redis
+	metrics *monitoring.Metrics
+}
+
+func New(c *cache.Redis, metrics *monitoring.Metrics) *Resolver {
+	return &Resolver{cache: c, metrics: metrics}
+}
+
+// MagnetLinks returns the magnet links of the hrefs, in order: magnet links
+// are kept as they are, protected links are replaced by the magnet links
+// they point to and any other link is dropped.
+func (r *Resolver) MagnetLinks(ctx context.Context, hrefs []string) []string {
+	var magnetLinks []string
+	for _, href := range hrefs {
+		if strings.HasPrefix(href, "magnet:") {
+			magnetLinks = append(magnetLinks, href)
+			continue
+		}
+		u, err := url.Parse(href)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		lr, ok := Lookup(u)
+		if !ok {
+			continue
+		}
+		magnetLinks = append(magnetLinks, r.resolve(ctx, lr, u)...)
+	}
+	return magnetLinks
+}
+
+// resolve returns the magnet links of the protected link, from the cache if possible.
+func (r *Resolver) resolve(ctx context.Context, lr LinkResolver, u *url.URL) []string {
+	key := fmt.Sprintf("resolvedLink:%s:%s", lr.Name(), u.String())
+	if cached, err := r.cache.Get(ctx, key); err == nil {
+		r.metrics.CacheHits.WithLabelValues("resolved_link").Inc()
+		return strings.Fields(string(cached))
+	}
+	r.metrics.CacheMisses.WithLabelValues("resolved_link").Inc()
+
+	links, err := lr.Resolve(ctx, u)
+	if err != nil {
+		r.metrics.LinkResolverRequests.WithLabelValues(lr.Name(), "error").Inc()
+		logging.Error().Err(err).Str("resolver", lr.Name()).Str("href", u.String()).Msg("Failed to resolve protected link")
+		return nil
+	}
+
+	var magnetLinks []string
+	for _, link := range links {
+		if strings.HasPrefix(link, "magnet:") {
+			magnetLinks = append(magnetLinks, link)
+		}
+	}
+	if len(magnetLinks) == 0 {
+		r.metrics.LinkResolverRequests.WithLabelValues(lr.Name(), "empty").Inc()
+		return nil
+	}
+	r.metrics.LinkResolverRequests.WithLabelValues(lr.Name(), "success").Inc()
+
+	// magnet links have no whitespace, so they are cached one per line
+	if err := r.cache.Set(ctx, key, []byte(strings.Join(magnetLinks, "\n"))); err != nil {
+		logging.Error().Err(err).Str("href", u.String()).Msg("Failed to set resolved link in cache")
+	}
+	return magnetLinks
+}
+
+// matchHost reports whether the host of the link is one of the hosts or a subdomain of it.
+func matchHost(u *url.URL, hosts []string) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/cache"
+	"github.com/felipemarinho97/torrent-indexer/monitoring"
+	"github.com/felipemarinho97/torrent-indexer/resolver"
+)
+
+const (
+	adLinkID     = "jVzYmJjZxYjYwMDZiVjZ2UTMmJGM3EmZ4E2M2cDZ0UGN4UmN5EWOlpDapRnY64mc11Dd49jO0VmbnFWb"
+	adLinkMagnet = "magnet:?xt=urn:btih:e9a96e84e4d763a8fa70bf156f5bd30b61f2fc5c"
+	soraID       = "c29yYWxpbmstcHJvdGVjdGVkLXBhZ2UtaWQtMTIzNDU2Nzg5MA"
+	soraToken    = "dG9rZW4tb2YtdGhlLXNvcmFsaW5rLXByb3RlY3RlZC1wYWdl"
+	soraMagnet   = "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=Sora"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error = %v", rawURL, err)
+	}
+	return u
+}
+
+func Test_adLinkResolver(t *testing.T) {
+	r := resolver.NewAdLinkResolver("seuvideo.xyz", "systemads.org")
+
+	tests := []struct {
+		name      string
+		href      string
+		wantMatch bool
+		want      []string
+		wantErr   bool
+	}{
+		{name: "seuvideo", href: "https://www.seuvideo.xyz/?id=" + adLinkID, wantMatch: true, want: []string{adLinkMagnet}},
+		{name: "systemads", href: "https://systemads.org/?id=" + adLinkID, wantMatch: true, want: []string{adLinkMagnet}},
+		{name: "invalid id", href: "https://www.seuvideo.xyz/?id=invalid_encoded_string", wantMatch: true, wantErr: true},
+		{name: "other host", href: "https://example.com/?id=" + adLinkID},
+		{name: "lookalike host", href: "https://notseuvideo.xyz/?id=" + adLinkID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := mustParse(t, tt.href)
+			if got := r.Match(u); got != tt.wantMatch {
+				t.Fatalf("Match() = %v, want %v", got, tt.wantMatch)
+			}
+			if !tt.wantMatch {
+				return
+			}
+			got, err := r.Resolve(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newSoraLinkServer serves a SoraLink protected page and its AJAX endpoint.
+func newSoraLinkServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("id") == soraID:
+			_, _ = w.Write([]byte(`<script>var sl = {"token":"` + soraToken + `","soralink_z":"sl_action"};</script>`))
+		case r.Method == http.MethodPost && r.URL.Path == "/wp-admin/admin-ajax.php":
+			_ = r.ParseForm()
+			if r.PostForm.Get("token") != soraToken || r.PostForm.Get("action") != "sl_action" {
+				http.Error(w, "bad token", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Location", soraMagnet)
+			w.WriteHeader(http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_soraLinkResolver(t *testing.T) {
+	server := newSoraLinkServer(t)
+	r := resolver.NewSoraLinkResolver(server.URL)
+
+	if r.Match(mustParse(t, "https://example.com/?id="+soraID)) {
+		t.Errorf("Match() = true for another host, want false")
+	}
+
+	u := mustParse(t, server.URL+"/?id="+soraID)
+	if !r.Match(u) {
+		t.Fatalf("Match() = false, want true")
+	}
+	got, err := r.Resolve(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := []string{soraMagnet}; !slices.Equal(got, want) {
+		t.Errorf("Resolve() = %v, want %v", got, want)
+	}
+
+	if _, err := r.Resolve(context.Background(), mustParse(t, server.URL+"/")); err == nil {
+		t.Errorf("Resolve() without id, want error")
+	}
+}
+
+// countingResolver resolves every link of its host to a fixed magnet link.
+type countingResolver struct {
+	calls int
+}
+
+func (*countingResolver) Name() string { return "counting" }
+
+func (*countingResolver) Match(u *url.URL) bool { return u.Host == "protected.test" }
+
+func (r *countingResolver) Resolve(_ context.Context, u *url.URL) ([]string, error) {
+	r.calls++
+	return []string{"magnet:?xt=urn:btih:" + strings.TrimPrefix(u.Path, "/"), "https://not-a-magnet.test/"}, nil
+}
+
+func Test_ResolverMagnetLinks(t *testing.T) {
+	counting := &countingResolver{}
+	if err := resolver.Register(counting); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := resolver.Register(counting); err == nil {
+		t.Errorf("Register() of a duplicate resolver, want error")
+	}
+
+	r := resolver.New(cache.NewMemory(), monitoring.NewMetrics())
+	hrefs := []string{
+		"magnet:?xt=urn:btih:first",
+		"https://example.com/post/",
+		"https://www.seuvideo.xyz/?id=" + adLinkID,
+		"#comments",
+		"https://protected.test/second",
+	}
+	want := []string{"magnet:?xt=urn:btih:first", adLinkMagnet, "magnet:?xt=urn:btih:second"}
+
+	for range 2 {
+		if got := r.MagnetLinks(context.Background(), hrefs); !slices.Equal(got, want) {
+			t.Errorf("MagnetLinks() = %v, want %v", got, want)
+		}
+	}
+	if counting.calls != 1 {
+		t.Errorf("resolver calls = %d, want 1 since the second one is cached", counting.calls)
+	}
+}
@@ -0,0 +1,60 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+// soraLinkResolver fetches the magnet links protected by SoraLink, whose
+// links carry the id of the protected page, e.g. https://vacadb.org/?id=...
+type soraLinkResolver struct {
+	baseURL string
+	host    string
+
+	// the fetcher keeps a cookie jar, so it is shared by all the links
+	once       sync.Once
+	fetcher    *utils.SoraLinkFetcher
+	fetcherErr error
+}
+
+// NewSoraLinkResolver returns a resolver of the SoraLink pages served from baseURL.
+func NewSoraLinkResolver(baseURL string) LinkResolver {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil {
+		host = u.Hostname()
+	}
+	return &soraLinkResolver{baseURL: baseURL, host: host}
+}
+
+func (*soraLinkResolver) Name() string {
+	return "soralink"
+}
+
+func (r *soraLinkResolver) Match(u *url.URL) bool {
+	return matchHost(u, []string{r.host})
+}
+
+func (r *soraLinkResolver) Resolve(ctx context.Context, u *url.URL) ([]string, error) {
+	id := u.Query().Get("id")
+	if id == "" {
+		return nil, fmt.Errorf("missing id in SoraLink link")
+	}
+
+	r.once.Do(func() {
+		// the resolved links are cached by the Resolver
+		r.fetcher, r.fetcherErr = utils.NewSoraLinkFetcher(r.baseURL, nil)
+	})
+	if r.fetcherErr != nil {
+		return nil, r.fetcherErr
+	}
+
+	link, err := r.fetcher.FetchLink(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return []string{link}, nil
+}
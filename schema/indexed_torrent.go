@@ -2,6 +2,14 @@ package schema
 
 import "time"
 
+// Categories of the indexed torrents.
+const (
+	CategoryMovie       = "movie"
+	CategorySeries      = "series"
+	CategoryAnime       = "anime"
+	CategoryDocumentary = "documentary"
+)
+
 type IndexedTorrent struct {
 	Title         string    `json:"title"`
 	OriginalTitle string    `json:"original_title"`
@@ -14,10 +22,23 @@ type IndexedTorrent struct {
 	InfoHash      string    `json:"info_hash"`
 	Trackers      []string  `json:"trackers"`
 	Size          string    `json:"size"`
+	Category      string    `json:"category,omitempty"`
 	Files         []File    `json:"files,omitempty"`
 	LeechCount    int       `json:"leech_count"`
 	SeedCount     int       `json:"seed_count"`
 	Similarity    float32   `json:"similarity"`
+	Season        int       `json:"season,omitempty"`
+	Episode       int       `json:"episode,omitempty"`
+	EpisodeEnd    int       `json:"episode_end,omitempty"`
+	SeasonPack    bool      `json:"season_pack,omitempty"`
+	Resolution    string    `json:"resolution,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	VideoCodec    string    `json:"video_codec,omitempty"`
+	HDR           bool      `json:"hdr,omitempty"`
+	DolbyVision   bool      `json:"dolby_vision,omitempty"`
+	AudioCodec    string    `json:"audio_codec,omitempty"`
+	AudioChannels string    `json:"audio_channels,omitempty"`
+	ReleaseGroup  string    `json:"release_group,omitempty"`
 }
 
 type File struct {
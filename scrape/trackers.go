@@ -11,6 +11,7 @@ import (
 
 	"github.com/felipemarinho97/torrent-indexer/cache"
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/proxy"
 )
 
 const (
@@ -39,7 +40,8 @@ func fetchDynamicTrackers(ctx context.Context, r *cache.Redis) ([]string, error)
 
 	// Fetch from GitHub and mirrors
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: proxy.NewTransport(http.DefaultTransport.(*http.Transport).Clone()),
 	}
 
 	var lastErr error
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/felipemarinho97/torrent-indexer/schema"
@@ -117,8 +119,91 @@ func (t *SearchIndexer) IndexTorrents(torrents []schema.IndexedTorrent) error {
 	return nil
 }
 
-// SearchTorrent searches indexed torrents in Meilisearch based on the query.
-func (t *SearchIndexer) SearchTorrent(query string, limit int) ([]schema.IndexedTorrent, error) {
+// AddFilterableAttributes adds the attributes to the ones the searches can
+// filter on, keeping the ones already set, since Meilisearch replaces the
+// whole list. Meilisearch applies it in the background.
+func (t *SearchIndexer) AddFilterableAttributes(attributes ...string) error {
+	url := fmt.Sprintf("%s/indexes/%s/settings/filterable-attributes", t.BaseURL, t.IndexName)
+
+	current, err := t.filterableAttributes(url)
+	if err != nil {
+		return err
+	}
+	merged := current
+	for _, attribute := range attributes {
+		name, _ := json.Marshal(attribute)
+		if !slices.ContainsFunc(current, func(a json.RawMessage) bool { return bytes.Equal(a, name) }) {
+			merged = append(merged, name)
+		}
+	}
+	if len(merged) == len(current) {
+		return nil
+	}
+
+	jsonData, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to marshal filterable attributes: %w", err)
+	}
+
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.APIKey))
+	}
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to set filterable attributes: status %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// filterableAttributes returns the filterable attributes of the index, which
+// are names or, in the newer versions, objects kept as they are. An index
+// that does not exist yet has none.
+func (t *SearchIndexer) filterableAttributes(url string) ([]json.RawMessage, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.APIKey))
+	}
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get filterable attributes: status %d, body: %s", resp.StatusCode, body)
+	}
+
+	var attributes []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&attributes); err != nil {
+		return nil, fmt.Errorf("failed to parse filterable attributes response: %w", err)
+	}
+	return attributes, nil
+}
+
+// SearchTorrent searches indexed torrents in Meilisearch based on the query,
+// keeping only the ones in the categories, if any. The categories are
+// filtered by Meilisearch, so the limit applies to the matching torrents.
+func (t *SearchIndexer) SearchTorrent(query string, limit int, categories ...string) ([]schema.IndexedTorrent, error) {
 	url := fmt.Sprintf("%s/indexes/%s/search", t.BaseURL, t.IndexName)
 	if limit > 100 {
 		limit = 100
@@ -127,6 +212,9 @@ func (t *SearchIndexer) SearchTorrent(query string, limit int) ([]schema.Indexed
 		"q":     query,
 		"limit": limit,
 	}
+	if len(categories) > 0 {
+		requestBody["filter"] = categoryFilter(categories)
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
@@ -163,6 +251,15 @@ func (t *SearchIndexer) SearchTorrent(query string, limit int) ([]schema.Indexed
 	return result.Hits, nil
 }
 
+// categoryFilter returns the Meilisearch filter matching any of the categories.
+func categoryFilter(categories []string) string {
+	quoted := make([]string, 0, len(categories))
+	for _, c := range categories {
+		quoted = append(quoted, `"`+strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(c)+`"`)
+	}
+	return fmt.Sprintf("category IN [%s]", strings.Join(quoted, ", "))
+}
+
 // GetStats retrieves statistics about the Meilisearch index including document count.
 // This method can be used for health checks and monitoring.
 func (t *SearchIndexer) GetStats() (*IndexStats, error) {
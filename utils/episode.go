@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// SeasonEpisode is the season and episode information found in a release name.
+// A zero Episode with a non-zero Season means the release is a season pack.
+type SeasonEpisode struct {
+	Season     int
+	Episode    int
+	EpisodeEnd int // last episode of a range, e.g. 5 for S01E01-E05
+	SeasonPack bool
+}
+
+var (
+	// S01E02, S01E01-E05, S01E01E02, S01E01-05
+	seasonEpisodeRE = regexp.MustCompile(`(?i)\bS(\d{1,2}) ?E(\d{1,3})(?:-?E(\d{1,3})|-(\d{1,3}))?\b`)
+	// 1x02, 1x01-1x05
+	crossEpisodeRE = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})(?:-(?:\d{1,2}x)?(\d{2,3}))?\b`)
+	// S01 alone, e.g. "S01 Complete"
+	seasonOnlyRE = regexp.MustCompile(`(?i)\bS(\d{1,2})\b`)
+	// 1ª Temporada, 1a Temporada, Temporada 1
+	temporadaRE = regexp.MustCompile(`(?i)(?:\b(\d{1,2}) ?[ªºa°]? ?Temporada|Temporada:? ?(\d{1,2})\b)`)
+	// Episódio 3, Episódios 01 a 05, Ep 3
+	episodioRE = regexp.MustCompile(`(?i)\b(?:Epis[oó]dios?|Ep\.?) ?(\d{1,3})(?: ?(?:a|ao|-|até) ?(\d{1,3}))?\b`)
+	// Temporada Completa, Complete Season
+	seasonPackRE = regexp.MustCompile(`(?i)\b(?:Temporada Completa|Complete|Completa)\b`)
+)
+
+// ParseSeasonEpisode extracts the season and episode information from a
+// release name, like "Show.S01E02.1080p" or "Show - 1ª Temporada Completa".
+// It returns the zero value if no season is found.
+func ParseSeasonEpisode(title string) SeasonEpisode {
+	var se SeasonEpisode
+
+	if m := seasonEpisodeRE.FindStringSubmatch(title); m != nil {
+		se.Season = atoi(m[1])
+		se.Episode = atoi(m[2])
+		se.EpisodeEnd = episodeEnd(se.Episode, m[3], m[4])
+		return se
+	}
+
+	if m := crossEpisodeRE.FindStringSubmatch(title); m != nil {
+		se.Season = atoi(m[1])
+		se.Episode = atoi(m[2])
+		se.EpisodeEnd = episodeEnd(se.Episode, m[3])
+		return se
+	}
+
+	if m := seasonOnlyRE.FindStringSubmatch(title); m != nil {
+		se.Season = atoi(m[1])
+	} else if m := temporadaRE.FindStringSubmatch(title); m != nil {
+		se.Season = atoi(m[1] + m[2])
+	}
+	if se.Season == 0 {
+		return SeasonEpisode{}
+	}
+
+	if m := episodioRE.FindStringSubmatch(title); m != nil && !seasonPackRE.MatchString(title) {
+		se.Episode = atoi(m[1])
+		se.EpisodeEnd = episodeEnd(se.Episode, m[2])
+	}
+	se.SeasonPack = se.Episode == 0
+
+	return se
+}
+
+// HasEpisode reports whether the release contains the given episode of the season.
+// Season packs contain every episode of their season.
+func (se SeasonEpisode) HasEpisode(season, episode int) bool {
+	if season != 0 && se.Season != season {
+		return false
+	}
+	if episode == 0 {
+		return true
+	}
+	if se.SeasonPack {
+		return season != 0
+	}
+	last := max(se.Episode, se.EpisodeEnd)
+	return se.Episode <= episode && episode <= last
+}
+
+// episodeEnd returns the first non-empty range end greater than the first episode.
+func episodeEnd(first int, candidates ...string) int {
+	for _, c := range candidates {
+		if end := atoi(c); end > first {
+			return end
+		}
+	}
+	return 0
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
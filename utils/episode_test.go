@@ -0,0 +1,87 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+func TestParseSeasonEpisode(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  utils.SeasonEpisode
+	}{
+		{
+			name:  "should parse SxxEyy",
+			title: "The.Boys.S04E02.1080p.WEB-DL",
+			want:  utils.SeasonEpisode{Season: 4, Episode: 2},
+		},
+		{
+			name:  "should parse episode range",
+			title: "The.Boys.S04E01-E03.1080p",
+			want:  utils.SeasonEpisode{Season: 4, Episode: 1, EpisodeEnd: 3},
+		},
+		{
+			name:  "should parse short episode range",
+			title: "The Boys S04E01-03 1080p",
+			want:  utils.SeasonEpisode{Season: 4, Episode: 1, EpisodeEnd: 3},
+		},
+		{
+			name:  "should parse NxNN",
+			title: "Friends 1x05 720p",
+			want:  utils.SeasonEpisode{Season: 1, Episode: 5},
+		},
+		{
+			name:  "should parse portuguese season pack",
+			title: "The Boys - 4ª Temporada Completa (2024)",
+			want:  utils.SeasonEpisode{Season: 4, SeasonPack: true},
+		},
+		{
+			name:  "should parse season without episode as pack",
+			title: "The.Boys.S04.1080p.WEB-DL",
+			want:  utils.SeasonEpisode{Season: 4, SeasonPack: true},
+		},
+		{
+			name:  "should parse Temporada N with episodes",
+			title: "The Boys Temporada 2 Episódios 01 a 04",
+			want:  utils.SeasonEpisode{Season: 2, Episode: 1, EpisodeEnd: 4},
+		},
+		{
+			name:  "should not parse movies",
+			title: "Duna Parte Dois (2024) 1080p",
+			want:  utils.SeasonEpisode{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.ParseSeasonEpisode(tt.title); got != tt.want {
+				t.Errorf("ParseSeasonEpisode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeasonEpisode_HasEpisode(t *testing.T) {
+	tests := []struct {
+		name    string
+		se      utils.SeasonEpisode
+		season  int
+		episode int
+		want    bool
+	}{
+		{"should match same episode", utils.SeasonEpisode{Season: 1, Episode: 2}, 1, 2, true},
+		{"should not match other episode", utils.SeasonEpisode{Season: 1, Episode: 2}, 1, 3, false},
+		{"should not match other season", utils.SeasonEpisode{Season: 2, Episode: 2}, 1, 2, false},
+		{"should match episode in range", utils.SeasonEpisode{Season: 1, Episode: 1, EpisodeEnd: 5}, 1, 3, true},
+		{"should match season pack", utils.SeasonEpisode{Season: 1, SeasonPack: true}, 1, 7, true},
+		{"should match season only", utils.SeasonEpisode{Season: 1, Episode: 4}, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.se.HasEpisode(tt.season, tt.episode); got != tt.want {
+				t.Errorf("HasEpisode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
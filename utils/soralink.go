@@ -13,6 +13,7 @@ import (
 
 	"github.com/felipemarinho97/torrent-indexer/cache"
 	"github.com/felipemarinho97/torrent-indexer/logging"
+	"github.com/felipemarinho97/torrent-indexer/proxy"
 )
 
 // SoraLinkFetcher handles fetching links from SoraLink-protected pages
@@ -28,7 +29,8 @@ type SoraLinkResult struct {
 	Error error
 }
 
-// NewSoraLinkFetcher creates a new SoraLink fetcher with a persistent cookie jar
+// NewSoraLinkFetcher creates a new SoraLink fetcher with a persistent cookie jar.
+// The links are not cached if cache is nil.
 func NewSoraLinkFetcher(baseURL string, cache *cache.Redis) (*SoraLinkFetcher, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
@@ -41,11 +43,11 @@ func NewSoraLinkFetcher(baseURL string, cache *cache.Redis) (*SoraLinkFetcher, e
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
-		Transport: &http.Transport{
+		Transport: proxy.NewTransport(&http.Transport{
 			MaxIdleConns:        10,
 			MaxIdleConnsPerHost: 5,
 			IdleConnTimeout:     90 * time.Second,
-		},
+		}),
 	}
 
 	return &SoraLinkFetcher{
@@ -59,10 +61,12 @@ func NewSoraLinkFetcher(baseURL string, cache *cache.Redis) (*SoraLinkFetcher, e
 func (s *SoraLinkFetcher) FetchLink(ctx context.Context, queryID string) (string, error) {
 	key := fmt.Sprintf("soralink:%s", queryID)
 	// try to get from cache
-	cachedLink, err := s.cache.Get(ctx, key)
-	if err == nil {
-		logging.Debug().Str("queryID", queryID[:30]+"...").Msg("Returning SoraLink from cache")
-		return string(cachedLink), nil
+	if s.cache != nil {
+		cachedLink, err := s.cache.Get(ctx, key)
+		if err == nil {
+			logging.Debug().Str("queryID", queryID[:30]+"...").Msg("Returning SoraLink from cache")
+			return string(cachedLink), nil
+		}
 	}
 
 	logging.Debug().Str("baseURL", s.baseURL).Str("queryID", queryID[:30]+"...").Msg("Fetching SoraLink page")
@@ -153,7 +157,9 @@ func (s *SoraLinkFetcher) FetchLink(ctx context.Context, queryID string) (string
 	logging.Debug().Str("magnet", location[:50]+"...").Msg("Extracted magnet link from Location header")
 
 	// cache the result
-	_ = s.cache.Set(ctx, key, []byte(location))
+	if s.cache != nil {
+		_ = s.cache.Set(ctx, key, []byte(location))
+	}
 
 	return location, nil
 }
@@ -33,6 +33,7 @@ func ParallelFlatMap[T any, R any](iterable []T, mapper func(item T) ([]R, error
 			items, err := mapper(link)
 			if err != nil {
 				errChan <- err
+				return
 			}
 			itChan <- items
 		}(link)
@@ -180,6 +181,29 @@ func GetEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// GetIndexerMirrorsFromEnv returns the comma separated list of mirror URLs
+// in the environment variable, or the default values if it is not set.
+// Each URL ends with "/".
+func GetIndexerMirrorsFromEnv(key string, defaultValues ...string) []string {
+	values := defaultValues
+	if value := os.Getenv(key); value != "" {
+		values = strings.Split(value, ",")
+	}
+
+	var mirrors []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.HasSuffix(value, "/") {
+			value += "/"
+		}
+		mirrors = append(mirrors, value)
+	}
+	return mirrors
+}
+
 func GetIndexerURLFromEnv(key string, defaultValue string) string {
 	value := GetEnvOrDefault(key, defaultValue)
 	if !strings.HasSuffix(value, "/") {
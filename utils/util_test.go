@@ -1,6 +1,8 @@
 package utils_test
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/felipemarinho97/torrent-indexer/utils"
@@ -193,3 +195,57 @@ func TestParseSize(t *testing.T) {
 		})
 	}
 }
+
+func TestParallelFlatMap(t *testing.T) {
+	var errs []error
+	got := utils.ParallelFlatMap([]int{1, 2, 3, 4}, func(i int) ([]int, error) {
+		if i%2 == 0 {
+			return nil, fmt.Errorf("even: %d", i)
+		}
+		return []int{i, i}, nil
+	}, func(err error) {
+		errs = append(errs, err)
+	})
+
+	if len(got) != 4 {
+		t.Errorf("ParallelFlatMap() = %v, want 4 items", got)
+	}
+	if len(errs) != 2 {
+		t.Errorf("ParallelFlatMap() errors = %v, want 2 errors", errs)
+	}
+}
+
+func TestGetIndexerMirrorsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		defaults []string
+		want     []string
+	}{
+		{
+			name:     "should use defaults when not set",
+			defaults: []string{"https://a.example", "https://b.example/"},
+			want:     []string{"https://a.example/", "https://b.example/"},
+		},
+		{
+			name:     "should split and trim env value",
+			env:      " https://c.example , https://d.example/,",
+			defaults: []string{"https://a.example/"},
+			want:     []string{"https://c.example/", "https://d.example/"},
+		},
+		{
+			name: "should return nil without mirrors",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INDEXER_TEST_MIRRORS", tt.env)
+			got := utils.GetIndexerMirrorsFromEnv("INDEXER_TEST_MIRRORS", tt.defaults...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetIndexerMirrorsFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -55,11 +56,16 @@ var websitePatterns = []string{
 	`\[?\s*%s(\s*\])?`,
 }
 
-var regexesOnce sync.Once
-var regexes []*regexp.Regexp
+var (
+	websitesMu sync.Mutex
+	regexes    []*regexp.Regexp
+)
 
 func getRegexes() []*regexp.Regexp {
-	regexesOnce.Do(func() {
+	websitesMu.Lock()
+	defer websitesMu.Unlock()
+
+	if regexes == nil {
 		var websites strings.Builder
 		websites.WriteString("(?i)(")
 		for _, prefix := range commonSubdomains {
@@ -78,10 +84,39 @@ func getRegexes() []*regexp.Regexp {
 		for _, pattern := range websitePatterns {
 			regexes = append(regexes, regexp.MustCompile(fmt.Sprintf(pattern, websitesStr)))
 		}
-	})
+	}
 	return regexes
 }
 
+// AddKnownWebsite adds the name and TLD of the host, e.g. "bludv-v2.xyz", to
+// the websites removed from the titles, so they are still scrubbed after a
+// site moves to a new domain.
+func AddKnownWebsite(host string) {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	dot := strings.LastIndex(host, ".")
+	if dot <= 0 {
+		return
+	}
+	name, tld := regexp.QuoteMeta(host[:dot]), host[dot:]
+
+	websitesMu.Lock()
+	defer websitesMu.Unlock()
+
+	containsFold := func(values []string, value string) bool {
+		return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+	}
+	if containsFold(commonWebsiteSLDs, name) && containsFold(commonTLDs, tld) {
+		return
+	}
+	if !containsFold(commonWebsiteSLDs, name) {
+		commonWebsiteSLDs = append(commonWebsiteSLDs, name)
+	}
+	if !containsFold(commonTLDs, tld) {
+		commonTLDs = append(commonTLDs, tld)
+	}
+	regexes = nil
+}
+
 // RemoveKnownWebsites removes known website patterns from the title.
 // It uses a set of common prefixes, names, and TLDs to identify and remove
 // website references from the title.
@@ -0,0 +1,41 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/felipemarinho97/torrent-indexer/utils"
+)
+
+func TestAddKnownWebsite(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  string
+		title string
+		want  string
+	}{
+		{
+			name:  "should remove a moved domain with a new TLD",
+			host:  "www.starckfilmes.fans",
+			title: "The Boys 4ª Temporada [ starckfilmes.fans ]",
+			want:  "The Boys 4ª Temporada",
+		},
+		{
+			name:  "should remove a moved domain with a new name",
+			host:  "bludv-v2.xyz",
+			title: "[ ACESSE bludv-v2.xyz ] Duna Parte Dois",
+			want:  "Duna Parte Dois",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.RemoveKnownWebsites(tt.title); got == tt.want {
+				t.Fatalf("RemoveKnownWebsites() = %v before adding %s", got, tt.host)
+			}
+			utils.AddKnownWebsite(tt.host)
+			if got := utils.RemoveKnownWebsites(tt.title); got != tt.want {
+				t.Errorf("RemoveKnownWebsites() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}